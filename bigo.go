@@ -16,10 +16,16 @@
 package bigo
 
 import (
+	"context"
+	"fmt"
+	"io/fs"
 	"net/http"
 	"os"
+	"os/signal"
 	"reflect"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/fym201/bigo/utl"
@@ -67,7 +73,24 @@ type Bigo struct {
 	urlPrefix string // For suburl support.
 	*Router
 
+	// Handlers to respond errors by status, see ErrorHandler.
+	errorHandlers map[int][]Handler
+
 	logger *Logger
+
+	// Lifecycle of the servers started by Run, RunHttp and RunHttps.
+	lock         sync.Mutex
+	servers      []*http.Server
+	onStart      []func()
+	onShutdown   []func()
+	startOnce    sync.Once
+	signalOnce   sync.Once
+	shutdownOnce sync.Once
+	shutdownErr  error
+	shuttingDown bool
+	done         chan struct{}
+	// How long to keep serving after readiness check starts to fail on Shutdown.
+	readinessDrain time.Duration
 }
 
 // NewWithLogger creates a bare bones Bigo instance.
@@ -79,13 +102,32 @@ func NewWithLogger(logger *Logger) *Bigo {
 		action:   func() {},
 		Router:   NewRouter(),
 		logger:   logger,
+		done:     make(chan struct{}),
+	}
+	if conf := GetConfig().Health; conf != nil {
+		m.readinessDrain = time.Duration(conf.ReadinessDrain) * time.Second
 	}
 	m.Router.m = m
 	m.Map(m.logger)
 	m.Map(defaultReturnHandler())
 	m.notFound = func(resp http.ResponseWriter, req *http.Request) {
 		c := m.createContext(resp, req)
-		c.handlers = append(c.handlers, http.NotFound)
+		c.handlers = append(c.handlers, func(ctx *Context) {
+			if !ctx.runErrorHandler(http.StatusNotFound, nil) {
+				http.NotFound(ctx.Resp, req)
+			}
+		})
+		c.run()
+	}
+	m.methodNotAllowed = func(resp http.ResponseWriter, req *http.Request) {
+		c := m.createContext(resp, req)
+		c.handlers = make([]Handler, 0, len(m.handlers)+1)
+		c.handlers = append(c.handlers, m.handlers...)
+		c.handlers = append(c.handlers, func(ctx *Context) {
+			if !ctx.runErrorHandler(http.StatusMethodNotAllowed, nil) {
+				http.Error(ctx.Resp, "405 method not allowed", http.StatusMethodNotAllowed)
+			}
+		})
 		c.run()
 	}
 	return m
@@ -102,21 +144,65 @@ func New() *Bigo {
 func Classic() *Bigo {
 	conf := GetConfig()
 	m := New()
+	if conf.Health != nil && conf.Health.Enable {
+		m.Use(Health())
+	}
+	if conf.Metrics != nil && conf.Metrics.Enable {
+		m.Use(Metrics())
+	}
+	if conf.Trace != nil && conf.Trace.Enable {
+		m.Use(Tracer())
+	}
 	if conf.LogLevel != LogLevelNone {
 		m.Use(ReqLogger())
 	}
 
+	if conf.CORS != nil && conf.CORS.Enable {
+		m.Use(CORS())
+	}
+
 	if conf.EnableGzip {
 		m.Use(Gziper())
 	}
+	if conf.EnableMinify {
+		m.Use(Minifier())
+	}
 
 	for i := 0; i < len(conf.Statics); i++ {
 		opt := conf.Statics[i]
-		mopt := StaticOptions{opt.Prefix, opt.SkipLogging, opt.IndexFile, nil, nil}
+		mopt := StaticOptions{
+			Prefix:       opt.Prefix,
+			SkipLogging:  opt.SkipLogging,
+			IndexFile:    opt.IndexFile,
+			Minify:       conf.EnableMinify,
+			ETag:         opt.ETag,
+			WeakETag:     opt.WeakETag,
+			CacheControl: opt.CacheControl,
+			Fingerprint:  opt.Fingerprint,
+			Listing:      opt.Listing,
+			ShowHidden:   opt.ShowHidden,
+		}
+		if len(opt.FS) > 0 {
+			fsys, err := GetFileSystem(opt.FS)
+			if err != nil {
+				panic("static: " + err.Error())
+			}
+			mopt.FileSystem = StaticFS(fsys, opt.Path)
+		}
+		if conf.EnableGzip {
+			mopt.GzipExtensions = conf.StaticExtensionsToGzip
+		}
 		m.Use(Static(opt.Path, mopt))
 	}
 
 	if conf.Tmpl != nil && conf.Tmpl.Enable {
+		var fsys fs.FS
+		if len(conf.Tmpl.FS) > 0 {
+			var err error
+			if fsys, err = GetFileSystem(conf.Tmpl.FS); err != nil {
+				panic("template: " + err.Error())
+			}
+		}
 		m.Use(Renderer(RenderOptions{
 			Directory:       conf.Tmpl.Directory,
 			Extensions:      conf.Tmpl.Extensions,
@@ -125,12 +211,21 @@ func Classic() *Bigo {
 			IndentJSON:      conf.Tmpl.IndentJSON,
 			IndentXML:       conf.Tmpl.IndentXML,
 			HTMLContentType: conf.Tmpl.HTMLContentType,
+			FileSystem:      fsys,
 		}))
 	}
 
 	if conf.I18n != nil && conf.I18n.Enable {
 		m.Use(I18n())
 	}
+
+	if conf.Session != nil && conf.Session.Enable {
+		m.Use(Sessioner())
+
+		if conf.CSRF != nil && conf.CSRF.Enable {
+			m.Use(CSRF())
+		}
+	}
 	m.Use(Recovery())
 	return m
 }
@@ -181,11 +276,26 @@ func (m *Bigo) createContext(rw http.ResponseWriter, req *http.Request) *Context
 	}
 	c.SetParent(m)
 	c.Map(c)
+
+	// Request-scoped logger carries fields of the request.
+	reqID := req.Header.Get(HeaderRequestID)
+	if !validRequestID(reqID) {
+		reqID = newRequestID()
+	}
+	c.requestID = reqID
+	c.logger = m.requestLogger(req, "request_id", reqID)
+	c.Map(c.logger)
 	c.MapTo(c.Resp, (*http.ResponseWriter)(nil))
 	c.Map(req)
 	return c
 }
 
+// requestLogger returns logger of Bigo with given fields and method and path of request.
+func (m *Bigo) requestLogger(req *http.Request, fields ...interface{}) *Logger {
+	logger := m.GetVal(reflect.TypeOf(m.logger)).Interface().(*Logger)
+	return logger.With(append(fields, "method", req.Method, "path", req.URL.Path)...)
+}
+
 // ServeHTTP is the HTTP Entry point for a Bigo instance.
 // Useful if you want to control your own HTTP server.
 // Be aware that none of middleware will run without registering any router.
@@ -212,15 +322,40 @@ func (m *Bigo) Run() {
 	}
 }
 
-//timeOut first arg is ReadTimeout, sencond arg is WriteTimeout,default is 30 Seconds
-func (m *Bigo) RunHttp(addr string, timeOut ...time.Duration) {
+// OnStart registers a hook that is called once before the first server starts listening.
+func (m *Bigo) OnStart(fn func()) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.onStart = append(m.onStart, fn)
+}
 
-	logger := m.Injector.GetVal(reflect.TypeOf(m.logger)).Interface().(*Logger)
-	logger.LogInfo("Http listening on %s (%s)\n", addr, Env)
-	//	if err := http.ListenAndServe(addr, m); err != nil {
-	//		panic(err)
-	//	}
+// OnShutdown registers a hook that is called after all servers have been drained.
+// Hooks are called in reverse order of registration.
+func (m *Bigo) OnShutdown(fn func()) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.onShutdown = append(m.onShutdown, fn)
+}
 
+// SetReadinessDrain sets how long Shutdown keeps serving after readiness check starts to fail,
+// so that load balancers stop sending new requests before servers are closed.
+// Default is ReadinessDrain of Health config.
+func (m *Bigo) SetReadinessDrain(d time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.readinessDrain = d
+}
+
+// IsShuttingDown returns true once Shutdown has been called.
+func (m *Bigo) IsShuttingDown() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.shuttingDown
+}
+
+// newServer creates a http.Server for given address and keeps track of it for Shutdown.
+// The first timeOut is ReadTimeout, the second one is WriteTimeout, both default to 30 seconds.
+func (m *Bigo) newServer(addr string, timeOut ...time.Duration) *http.Server {
 	server := &http.Server{Addr: addr, Handler: m}
 	if len(timeOut) > 0 {
 		server.ReadTimeout = timeOut[0]
@@ -233,7 +368,117 @@ func (m *Bigo) RunHttp(addr string, timeOut ...time.Duration) {
 	} else {
 		server.WriteTimeout = time.Second * 30
 	}
-	server.ListenAndServe()
+
+	m.lock.Lock()
+	if m.shuttingDown {
+		// Make ListenAndServe return http.ErrServerClosed right away.
+		server.Close()
+	}
+	m.servers = append(m.servers, server)
+	m.lock.Unlock()
+
+	m.startOnce.Do(func() {
+		m.lock.Lock()
+		hooks := m.onStart
+		m.lock.Unlock()
+		for _, fn := range hooks {
+			fn()
+		}
+	})
+	m.signalOnce.Do(m.handleSignals)
+	return server
+}
+
+// handleSignals drains all servers when the process receives SIGINT or SIGTERM.
+func (m *Bigo) handleSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-ch:
+			m.logger.LogInfo("Received %s, shutting down", sig)
+			timeout := time.Duration(GetConfig().ShutdownTimeout) * time.Second
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			if err := m.Shutdown(ctx); err != nil {
+				m.logger.LogError("Shutdown: %v", err)
+			}
+		case <-m.done:
+		}
+		signal.Stop(ch)
+	}()
+}
+
+// Shutdown gracefully stops all running servers without interrupting active requests,
+// then calls the OnShutdown hooks. Readiness check fails at once, while servers keep serving
+// for the readiness drain before being closed. In-flight requests are given until ctx is done to finish.
+// Calls after the first one wait for the first shutdown to complete and return its result.
+func (m *Bigo) Shutdown(ctx context.Context) error {
+	m.shutdownOnce.Do(func() {
+		defer close(m.done)
+
+		m.lock.Lock()
+		m.shuttingDown = true
+		servers := m.servers
+		hooks := m.onShutdown
+		drain := m.readinessDrain
+		m.lock.Unlock()
+
+		if drain > 0 && len(servers) > 0 {
+			timer := time.NewTimer(drain)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+			}
+			timer.Stop()
+		}
+
+		for _, server := range servers {
+			if err := server.Shutdown(ctx); err != nil && m.shutdownErr == nil {
+				m.shutdownErr = err
+			}
+		}
+		for i := len(hooks) - 1; i >= 0; i-- {
+			m.runShutdownHook(hooks[i])
+		}
+	})
+	<-m.done
+	return m.shutdownErr
+}
+
+// runShutdownHook calls fn and recovers from its panic, so that a broken hook
+// neither skips the others nor leaves Shutdown waiters blocked.
+func (m *Bigo) runShutdownHook(fn func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			m.logger.LogError("OnShutdown hook panic: %v", err)
+			if m.shutdownErr == nil {
+				m.shutdownErr = fmt.Errorf("OnShutdown hook panic: %v", err)
+			}
+		}
+	}()
+	fn()
+}
+
+// serve waits for Shutdown to complete when the server has been closed by it.
+func (m *Bigo) serve(err error) error {
+	if err == http.ErrServerClosed {
+		<-m.done
+		return nil
+	}
+	return err
+}
+
+//timeOut first arg is ReadTimeout, sencond arg is WriteTimeout,default is 30 Seconds
+func (m *Bigo) RunHttp(addr string, timeOut ...time.Duration) {
+
+	logger := m.Injector.GetVal(reflect.TypeOf(m.logger)).Interface().(*Logger)
+	logger.LogInfo("Http listening on %s (%s)\n", addr, Env)
+
+	server := m.newServer(addr, timeOut...)
+	if err := m.serve(server.ListenAndServe()); err != nil {
+		logger.LogError("Http server on %s: %v", addr, err)
+	}
 }
 
 func (m *Bigo) RunHttps(addr string, cerFile string, keyFile string, timeOut ...time.Duration) {
@@ -244,23 +489,9 @@ func (m *Bigo) RunHttps(addr string, cerFile string, keyFile string, timeOut ...
 	// 	SSLRedirect: true,
 	// 	SSLHost:     addr, // This is optional in production. The default behavior is to just redirect the request to the https protocol. Example: http://github.com/some_page would be redirected to https://github.com/some_page.
 	// }))
-	//	if err := http.ListenAndServeTLS(addr, cerFile, keyFile, m); err != nil {
-	//		panic(err)
-	//	}
-
-	server := &http.Server{Addr: addr, Handler: m}
-	if len(timeOut) > 0 {
-		server.ReadTimeout = timeOut[0]
-	} else {
-		server.ReadTimeout = time.Second * 30
-	}
 
-	if len(timeOut) >= 2 {
-		server.WriteTimeout = timeOut[1]
-	} else {
-		server.WriteTimeout = time.Second * 30
-	}
-	if err := server.ListenAndServeTLS(cerFile, keyFile); err != nil {
+	server := m.newServer(addr, timeOut...)
+	if err := m.serve(server.ListenAndServeTLS(cerFile, keyFile)); err != nil {
 		panic(err)
 	}
 }
@@ -0,0 +1,631 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package binding is a middleware that provides request data binding and validation for bigo.
+//
+// Fields are filled by struct tags:
+//
+//	form:"name"   from query string, urlencoded or multipart form
+//	json:"name"   from JSON body
+//	xml:"name"    from XML body
+//	param:"name"  from route params, e.g. ":id" of "/user/:id"
+//
+// and validated by the binding tag, e.g. `binding:"Required;MaxSize(50);Email"`.
+package binding
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fym201/bigo"
+	"github.com/fym201/bigo/utl"
+)
+
+var (
+	// MaxMemory represents maximum amount of memory to use when parsing a multipart form.
+	// Set this to whatever value you prefer; default is 10 MB.
+	MaxMemory = int64(1024 * 1024 * 10)
+
+	// NameMapper maps a struct field name to the form field name when no form tag is given.
+	// Default converts CamelCase to snake_case.
+	NameMapper = func(name string) string {
+		buf := make([]byte, 0, len(name)+4)
+		for i := 0; i < len(name); i++ {
+			c := name[i]
+			if 'A' <= c && c <= 'Z' {
+				if i > 0 {
+					buf = append(buf, '_')
+				}
+				c += 'a' - 'A'
+			}
+			buf = append(buf, c)
+		}
+		return string(buf)
+	}
+)
+
+type (
+	// Validator is the interface that wraps the Validate method.
+	// Implement it on your struct to perform additional validation
+	// after the binding tags have been checked.
+	Validator interface {
+		Validate(*bigo.Context, Errors) Errors
+	}
+
+	// ErrorHandler is the interface that wraps the Error method.
+	// Implement it on your struct to handle binding errors before
+	// the next handler is invoked, e.g. to write a 400 response.
+	ErrorHandler interface {
+		Error(*bigo.Context, Errors)
+	}
+)
+
+// Bind wraps up the functionality of the Form, MultipartForm, Json and Xml middleware
+// according to the Content-Type and verb of the request.
+// A Content-Type is required for POST, PUT and PATCH requests; otherwise query
+// string and form values are used. Route params are bound for all of them.
+// The bound struct and an Errors value are mapped into the context,
+// pass ifacePtr to map the struct to an interface as well.
+func Bind(obj interface{}, ifacePtr ...interface{}) bigo.Handler {
+	return func(ctx *bigo.Context) {
+		bind(ctx, obj, ifacePtr...)
+	}
+}
+
+// Form binds query string and urlencoded form values to the struct.
+func Form(obj interface{}, ifacePtr ...interface{}) bigo.Handler {
+	return func(ctx *bigo.Context) {
+		bindForm(ctx, obj, ifacePtr...)
+	}
+}
+
+// MultipartForm binds multipart form values and files to the struct.
+// Use *multipart.FileHeader or []*multipart.FileHeader fields for files.
+func MultipartForm(obj interface{}, ifacePtr ...interface{}) bigo.Handler {
+	return func(ctx *bigo.Context) {
+		bindMultipartForm(ctx, obj, ifacePtr...)
+	}
+}
+
+// Json binds JSON request body to the struct.
+func Json(obj interface{}, ifacePtr ...interface{}) bigo.Handler {
+	return func(ctx *bigo.Context) {
+		bindJson(ctx, obj, ifacePtr...)
+	}
+}
+
+// Xml binds XML request body to the struct.
+func Xml(obj interface{}, ifacePtr ...interface{}) bigo.Handler {
+	return func(ctx *bigo.Context) {
+		bindXml(ctx, obj, ifacePtr...)
+	}
+}
+
+// Validate is a middleware that validates the struct which has been mapped
+// into the context, and maps an Errors value with the result.
+func Validate(obj interface{}) bigo.Handler {
+	return func(ctx *bigo.Context) {
+		val := ctx.GetVal(reflect.TypeOf(obj))
+		if !val.IsValid() {
+			panic("binding: " + reflect.TypeOf(obj).String() + " has not been mapped")
+		}
+		ptr := reflect.New(val.Type())
+		ptr.Elem().Set(val)
+		errors := validateStruct(Errors{}, ptr.Interface())
+		if validator, ok := ptr.Interface().(Validator); ok {
+			errors = validator.Validate(ctx, errors)
+		}
+		ctx.Map(errors)
+		ctx.Map(ptr.Elem().Interface())
+	}
+}
+
+// RawValidate validates the struct (or pointer to struct) by its binding tags without a request.
+func RawValidate(obj interface{}) Errors {
+	return validateStruct(Errors{}, obj)
+}
+
+func bind(ctx *bigo.Context, obj interface{}, ifacePtr ...interface{}) {
+	contentType := ctx.Req.Header.Get("Content-Type")
+	method := ctx.Req.Method
+	if method == "POST" || method == "PUT" || method == "PATCH" || len(contentType) > 0 {
+		switch {
+		case strings.Contains(contentType, "form-urlencoded"):
+			bindForm(ctx, obj, ifacePtr...)
+		case strings.Contains(contentType, "multipart/form-data"):
+			bindMultipartForm(ctx, obj, ifacePtr...)
+		case strings.Contains(contentType, "json"):
+			bindJson(ctx, obj, ifacePtr...)
+		case strings.Contains(contentType, "xml"):
+			bindXml(ctx, obj, ifacePtr...)
+		default:
+			var errors Errors
+			if len(contentType) == 0 {
+				errors.Add([]string{}, ERR_CONTENT_TYPE, "Empty Content-Type")
+			} else {
+				errors.Add([]string{}, ERR_CONTENT_TYPE, "Unsupported Content-Type")
+			}
+			// Still map a zero value so the handler does not fail on injection.
+			validateAndMap(ctx, newObj(obj), errors, ifacePtr...)
+		}
+		return
+	}
+	bindForm(ctx, obj, ifacePtr...)
+}
+
+func bindForm(ctx *bigo.Context, obj interface{}, ifacePtr ...interface{}) {
+	var errors Errors
+	v := newObj(obj)
+	if err := ctx.Req.ParseForm(); err != nil {
+		errors.Add([]string{}, ERR_DESERIALIZATION, err.Error())
+	}
+	errors = mapForm(v, ctx.Req.Form, nil, errors)
+	validateAndMap(ctx, v, errors, ifacePtr...)
+}
+
+func bindMultipartForm(ctx *bigo.Context, obj interface{}, ifacePtr ...interface{}) {
+	var errors Errors
+	v := newObj(obj)
+	if ctx.Req.MultipartForm == nil {
+		if err := ctx.Req.ParseMultipartForm(MaxMemory); err != nil {
+			errors.Add([]string{}, ERR_DESERIALIZATION, err.Error())
+		}
+	}
+	if form := ctx.Req.MultipartForm; form != nil {
+		errors = mapForm(v, form.Value, form.File, errors)
+	}
+	validateAndMap(ctx, v, errors, ifacePtr...)
+}
+
+func bindJson(ctx *bigo.Context, obj interface{}, ifacePtr ...interface{}) {
+	var errors Errors
+	v := newObj(obj)
+	if ctx.Req.Request.Body != nil {
+		defer ctx.Req.Request.Body.Close()
+		if err := json.NewDecoder(ctx.Req.Request.Body).Decode(v.Interface()); err != nil && err != io.EOF {
+			errors.Add([]string{}, ERR_DESERIALIZATION, err.Error())
+		}
+	}
+	validateAndMap(ctx, v, errors, ifacePtr...)
+}
+
+func bindXml(ctx *bigo.Context, obj interface{}, ifacePtr ...interface{}) {
+	var errors Errors
+	v := newObj(obj)
+	if ctx.Req.Request.Body != nil {
+		defer ctx.Req.Request.Body.Close()
+		if err := xml.NewDecoder(ctx.Req.Request.Body).Decode(v.Interface()); err != nil && err != io.EOF {
+			errors.Add([]string{}, ERR_DESERIALIZATION, err.Error())
+		}
+	}
+	validateAndMap(ctx, v, errors, ifacePtr...)
+}
+
+// newObj returns a pointer to a new zero value of the struct type of obj.
+func newObj(obj interface{}) reflect.Value {
+	typ := reflect.TypeOf(obj)
+	if typ.Kind() == reflect.Ptr {
+		panic("binding: pointers are not accepted as binding models")
+	}
+	if typ.Kind() != reflect.Struct {
+		panic("binding: only structs are accepted as binding models")
+	}
+	return reflect.New(typ)
+}
+
+// validateAndMap binds route params, validates the struct and maps
+// the struct and errors into the context.
+func validateAndMap(ctx *bigo.Context, obj reflect.Value, errors Errors, ifacePtr ...interface{}) {
+	errors = mapParams(ctx, obj, errors)
+	errors = validateStruct(errors, obj.Interface())
+	if validator, ok := obj.Interface().(Validator); ok {
+		errors = validator.Validate(ctx, errors)
+	}
+
+	ctx.Map(errors)
+	ctx.Map(obj.Interface())
+	ctx.Map(obj.Elem().Interface())
+	if len(ifacePtr) > 0 {
+		ctx.MapTo(obj.Elem().Interface(), ifacePtr[0])
+	}
+
+	if handler, ok := obj.Interface().(ErrorHandler); ok && len(errors) > 0 {
+		handler.Error(ctx, errors)
+	}
+}
+
+var (
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeaderSliceType = reflect.TypeOf([]*multipart.FileHeader(nil))
+	timeType            = reflect.TypeOf(time.Time{})
+)
+
+// isNestedStruct returns true if the field should be walked into.
+func isNestedStruct(field reflect.StructField) bool {
+	typ := field.Type
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ.Kind() == reflect.Struct && typ != timeType
+}
+
+// fieldValue returns the settable value of the field, allocating nil struct pointers.
+func fieldValue(v reflect.Value) reflect.Value {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return v.Elem()
+	}
+	return v
+}
+
+// mapForm takes values from the form data and puts them into the struct.
+func mapForm(obj reflect.Value, form map[string][]string,
+	files map[string][]*multipart.FileHeader, errors Errors) Errors {
+	v := reflect.Indirect(obj)
+	typ := v.Type()
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		fv := v.Field(i)
+		if !fv.CanSet() {
+			continue
+		}
+
+		tag := field.Tag.Get("form")
+		if tag == "-" {
+			continue
+		}
+		if len(tag) == 0 && isNestedStruct(field) {
+			errors = mapForm(fieldValue(fv), form, files, errors)
+			continue
+		}
+
+		name := tag
+		if len(name) == 0 {
+			name = NameMapper(field.Name)
+		}
+
+		switch field.Type {
+		case fileHeaderType:
+			if fhs := files[name]; len(fhs) > 0 {
+				fv.Set(reflect.ValueOf(fhs[0]))
+			}
+			continue
+		case fileHeaderSliceType:
+			if fhs := files[name]; len(fhs) > 0 {
+				fv.Set(reflect.ValueOf(fhs))
+			}
+			continue
+		}
+
+		inputs, ok := form[name]
+		if !ok || len(inputs) == 0 {
+			continue
+		}
+		if fv.Kind() == reflect.Slice {
+			slice := reflect.MakeSlice(fv.Type(), len(inputs), len(inputs))
+			for j := range inputs {
+				errors = setWithProperType(inputs[j], slice.Index(j), name, errors)
+			}
+			fv.Set(slice)
+		} else {
+			errors = setWithProperType(inputs[0], fv, name, errors)
+		}
+	}
+	return errors
+}
+
+// mapParams takes values from the route params and puts them into the struct fields with param tag.
+func mapParams(ctx *bigo.Context, obj reflect.Value, errors Errors) Errors {
+	v := reflect.Indirect(obj)
+	typ := v.Type()
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		fv := v.Field(i)
+		if !fv.CanSet() {
+			continue
+		}
+
+		tag := field.Tag.Get("param")
+		if len(tag) == 0 || tag == "-" {
+			if isNestedStruct(field) && (field.Anonymous || !fv.IsZero()) {
+				errors = mapParams(ctx, fieldValue(fv), errors)
+			}
+			continue
+		}
+		if val := ctx.Params(tag); len(val) > 0 {
+			errors = setWithProperType(val, fv, tag, errors)
+		}
+	}
+	return errors
+}
+
+// setWithProperType sets the string value to the field in its own type.
+func setWithProperType(val string, field reflect.Value, name string, errors Errors) Errors {
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if len(val) == 0 {
+			val = "0"
+		}
+		i, err := strconv.ParseInt(val, 10, field.Type().Bits())
+		if err != nil {
+			errors.Add([]string{name}, ERR_INTERGER_TYPE, "Value could not be parsed as integer")
+		} else {
+			field.SetInt(i)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if len(val) == 0 {
+			val = "0"
+		}
+		u, err := strconv.ParseUint(val, 10, field.Type().Bits())
+		if err != nil {
+			errors.Add([]string{name}, ERR_INTERGER_TYPE, "Value could not be parsed as unsigned integer")
+		} else {
+			field.SetUint(u)
+		}
+	case reflect.Bool:
+		if val == "on" {
+			field.SetBool(true)
+			break
+		}
+		if len(val) == 0 {
+			val = "false"
+		}
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			errors.Add([]string{name}, ERR_BOOLEAN_TYPE, "Value could not be parsed as boolean")
+		} else {
+			field.SetBool(b)
+		}
+	case reflect.Float32, reflect.Float64:
+		if len(val) == 0 {
+			val = "0.0"
+		}
+		f, err := strconv.ParseFloat(val, field.Type().Bits())
+		if err != nil {
+			errors.Add([]string{name}, ERR_FLOAT_TYPE, "Value could not be parsed as float")
+		} else {
+			field.SetFloat(f)
+		}
+	case reflect.String:
+		field.SetString(val)
+	}
+	return errors
+}
+
+// Rule represents a custom validation rule.
+type Rule struct {
+	// IsMatch checks if the rule in binding tag is this one, e.g. rule == "Mobile".
+	IsMatch func(rule string) bool
+	// IsValid validates the field value and appends its own error if it is not valid.
+	IsValid func(errors Errors, name string, v interface{}) (bool, Errors)
+}
+
+var customRules []*Rule
+
+// AddRule adds a custom validation rule, custom rules are checked after built-in ones.
+func AddRule(r *Rule) {
+	customRules = append(customRules, r)
+}
+
+var (
+	alphaDashPattern    = regexp.MustCompile(`[^\d\w-_]`)
+	alphaDashDotPattern = regexp.MustCompile(`[^\d\w-_\.]`)
+)
+
+// validateStruct validates fields of the struct (or pointer to struct) by their binding tags.
+func validateStruct(errors Errors, obj interface{}) Errors {
+	v := reflect.ValueOf(obj)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return errors
+		}
+		v = v.Elem()
+	}
+	typ := v.Type()
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		fv := v.Field(i)
+		if len(field.PkgPath) > 0 {
+			continue // Unexported.
+		}
+
+		rules := field.Tag.Get("binding")
+		if rules == "-" {
+			continue
+		}
+
+		if isNestedStruct(field) && !(fv.Kind() == reflect.Ptr && fv.IsNil()) {
+			if fv.CanAddr() && fv.Kind() != reflect.Ptr {
+				errors = validateStruct(errors, fv.Addr().Interface())
+			} else {
+				errors = validateStruct(errors, fv.Interface())
+			}
+		} else if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Struct {
+			for j := 0; j < fv.Len(); j++ {
+				errors = validateStruct(errors, fv.Index(j).Addr().Interface())
+			}
+		}
+
+		if len(rules) > 0 {
+			errors = validateField(errors, fieldName(field), fv, rules)
+		}
+	}
+	return errors
+}
+
+// fieldName returns the name of field used in errors.
+func fieldName(field reflect.StructField) string {
+	for _, key := range []string{"form", "json", "xml", "param"} {
+		if name := strings.Split(field.Tag.Get(key), ",")[0]; len(name) > 0 && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// ruleArgs returns the arguments of a rule, e.g. "Range(1,10)" -> ["1", "10"].
+func ruleArgs(rule, name string) []string {
+	return strings.Split(strings.TrimSuffix(strings.TrimPrefix(rule, name+"("), ")"), ",")
+}
+
+// valueSize returns length of string in runes, or length of slice, array and map.
+func valueSize(fv reflect.Value) (int, bool) {
+	switch fv.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(fv.String()), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return fv.Len(), true
+	}
+	return 0, false
+}
+
+// validateField validates the field value by the rules of its binding tag.
+// Rules other than Required and Default are skipped when the value is empty.
+func validateField(errors Errors, name string, fv reflect.Value, tag string) Errors {
+	rules := strings.Split(tag, ";")
+	isZero := fv.IsZero() || ((fv.Kind() == reflect.Slice || fv.Kind() == reflect.Map) && fv.Len() == 0)
+
+	for _, rule := range rules {
+		if isZero && strings.HasPrefix(rule, "Default(") && fv.CanSet() {
+			errors = setWithProperType(ruleArgs(rule, "Default")[0], fv, name, errors)
+			isZero = fv.IsZero()
+		}
+	}
+
+	value := fv.Interface()
+	str := utl.ToStr(value)
+	if fv.Kind() == reflect.Ptr && !fv.IsNil() {
+		str = utl.ToStr(fv.Elem().Interface())
+	}
+
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if len(rule) == 0 || strings.HasPrefix(rule, "Default(") {
+			continue
+		}
+		if rule == "Required" {
+			if isZero {
+				errors.Add([]string{name}, ERR_REQUIRED, "Required")
+				return errors
+			}
+			continue
+		}
+		if isZero {
+			continue
+		}
+
+		switch {
+		case rule == "AlphaDash":
+			if alphaDashPattern.MatchString(str) {
+				errors.Add([]string{name}, ERR_ALPHA_DASH, "AlphaDash")
+				return errors
+			}
+		case rule == "AlphaDashDot":
+			if alphaDashDotPattern.MatchString(str) {
+				errors.Add([]string{name}, ERR_ALPHA_DASH_DOT, "AlphaDashDot")
+				return errors
+			}
+		case strings.HasPrefix(rule, "Size("):
+			size, _ := strconv.Atoi(ruleArgs(rule, "Size")[0])
+			if n, ok := valueSize(fv); ok && n != size {
+				errors.Add([]string{name}, ERR_SIZE, "Size")
+				return errors
+			}
+		case strings.HasPrefix(rule, "MinSize("):
+			min, _ := strconv.Atoi(ruleArgs(rule, "MinSize")[0])
+			if n, ok := valueSize(fv); ok && n < min {
+				errors.Add([]string{name}, ERR_MIN_SIZE, "MinSize")
+				return errors
+			}
+		case strings.HasPrefix(rule, "MaxSize("):
+			max, _ := strconv.Atoi(ruleArgs(rule, "MaxSize")[0])
+			if n, ok := valueSize(fv); ok && n > max {
+				errors.Add([]string{name}, ERR_MAX_SIZE, "MaxSize")
+				return errors
+			}
+		case strings.HasPrefix(rule, "Range("):
+			args := ruleArgs(rule, "Range")
+			if len(args) != 2 {
+				panic(fmt.Sprintf("binding: invalid rule %s of field %s", rule, name))
+			}
+			min, _ := strconv.ParseFloat(args[0], 64)
+			max, _ := strconv.ParseFloat(args[1], 64)
+			val, err := strconv.ParseFloat(str, 64)
+			if err != nil || val < min || val > max {
+				errors.Add([]string{name}, ERR_RANGE, "Range")
+				return errors
+			}
+		case rule == "Email":
+			if !utl.IsEmail(str) {
+				errors.Add([]string{name}, ERR_EMAIL, "Email")
+				return errors
+			}
+		case rule == "Url":
+			if !utl.IsUrl(str) {
+				errors.Add([]string{name}, ERR_URL, "Url")
+				return errors
+			}
+		case strings.HasPrefix(rule, "In("):
+			if !utl.IsSliceContainsStr(ruleArgs(rule, "In"), str) {
+				errors.Add([]string{name}, ERR_IN, "In")
+				return errors
+			}
+		case strings.HasPrefix(rule, "NotIn("):
+			if utl.IsSliceContainsStr(ruleArgs(rule, "NotIn"), str) {
+				errors.Add([]string{name}, ERR_NOT_IN, "NotIn")
+				return errors
+			}
+		case strings.HasPrefix(rule, "Include("):
+			if !strings.Contains(str, strings.TrimSuffix(strings.TrimPrefix(rule, "Include("), ")")) {
+				errors.Add([]string{name}, ERR_INCLUDE, "Include")
+				return errors
+			}
+		case strings.HasPrefix(rule, "Exclude("):
+			if strings.Contains(str, strings.TrimSuffix(strings.TrimPrefix(rule, "Exclude("), ")")) {
+				errors.Add([]string{name}, ERR_EXCLUDE, "Exclude")
+				return errors
+			}
+		default:
+			matched := false
+			for _, r := range customRules {
+				if !r.IsMatch(rule) {
+					continue
+				}
+				matched = true
+				var ok bool
+				if ok, errors = r.IsValid(errors, name, value); !ok {
+					return errors
+				}
+			}
+			if !matched {
+				panic(fmt.Sprintf("binding: unknown rule %s of field %s", rule, name))
+			}
+		}
+	}
+	return errors
+}
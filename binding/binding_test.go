@@ -0,0 +1,188 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package binding
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/fym201/bigo"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type Address struct {
+	City string `form:"city" json:"city" binding:"Required"`
+}
+
+type Post struct {
+	Id      int      `param:"id"`
+	Title   string   `form:"title" json:"title" xml:"title" binding:"Required;MaxSize(10)"`
+	Email   string   `form:"email" json:"email" xml:"email" binding:"Email"`
+	Tags    []string `form:"tag" json:"tags"`
+	Rating  int      `form:"rating" json:"rating" binding:"Range(1,5)"`
+	Kind    string   `form:"kind" json:"kind" binding:"Default(post);In(post,page)"`
+	private string
+	Address
+}
+
+type UploadForm struct {
+	Title string                `form:"title"`
+	File  *multipart.FileHeader `form:"file" binding:"Required"`
+}
+
+func performRequest(m *bigo.Bigo, method, path, contentType string, body *strings.Reader) *httptest.ResponseRecorder {
+	resp := httptest.NewRecorder()
+	req, err := http.NewRequest(method, path, body)
+	So(err, ShouldBeNil)
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	m.ServeHTTP(resp, req)
+	return resp
+}
+
+func Test_Bind(t *testing.T) {
+	Convey("Bind form data and route params", t, func() {
+		m := bigo.New()
+		m.Post("/post/:id", Bind(Post{}), func(post Post, errs Errors) {
+			So(errs.Len(), ShouldEqual, 0)
+			So(post.Id, ShouldEqual, 12)
+			So(post.Title, ShouldEqual, "Hello")
+			So(post.Tags, ShouldResemble, []string{"a", "b"})
+			So(post.Rating, ShouldEqual, 5)
+			So(post.Kind, ShouldEqual, "post")
+			So(post.City, ShouldEqual, "Beijing")
+		})
+
+		form := url.Values{"title": {"Hello"}, "email": {"joe@example.com"}, "tag": {"a", "b"}, "rating": {"5"}, "city": {"Beijing"}}
+		resp := performRequest(m, "POST", "/post/12", "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+		So(resp.Code, ShouldEqual, http.StatusOK)
+	})
+
+	Convey("Bind query string for GET request", t, func() {
+		m := bigo.New()
+		m.Get("/", Bind(Post{}), func(post *Post, errs Errors) {
+			So(errs.Len(), ShouldEqual, 0)
+			So(post.Title, ShouldEqual, "Hello")
+		})
+		performRequest(m, "GET", "/?title=Hello&city=Shanghai", "", strings.NewReader(""))
+	})
+
+	Convey("Bind JSON body", t, func() {
+		m := bigo.New()
+		m.Put("/post/:id", Bind(Post{}), func(post Post, errs Errors) {
+			So(errs.Len(), ShouldEqual, 0)
+			So(post.Id, ShouldEqual, 3)
+			So(post.Tags, ShouldResemble, []string{"go"})
+			So(post.City, ShouldEqual, "Beijing")
+		})
+		performRequest(m, "PUT", "/post/3", "application/json; charset=utf-8",
+			strings.NewReader(`{"title":"Hello","tags":["go"],"city":"Beijing"}`))
+	})
+
+	Convey("Bind XML body", t, func() {
+		m := bigo.New()
+		m.Post("/", Bind(Post{}), func(post Post, errs Errors) {
+			So(post.Title, ShouldEqual, "Hello")
+			So(errs.Has(ERR_REQUIRED), ShouldBeTrue)
+			So(errs.Fields(), ShouldResemble, []string{"city"})
+		})
+		performRequest(m, "POST", "/", "text/xml", strings.NewReader(`<Post><title>Hello</title></Post>`))
+	})
+
+	Convey("Bind with unsupported content type", t, func() {
+		m := bigo.New()
+		m.Post("/", Bind(Post{}), func(errs Errors) {
+			So(errs.Has(ERR_CONTENT_TYPE), ShouldBeTrue)
+		})
+		performRequest(m, "POST", "/", "", strings.NewReader(""))
+	})
+
+	Convey("Bind with malformed JSON", t, func() {
+		m := bigo.New()
+		m.Post("/", Json(Post{}), func(errs Errors) {
+			So(errs.Has(ERR_DESERIALIZATION), ShouldBeTrue)
+		})
+		performRequest(m, "POST", "/", "application/json", strings.NewReader(`{"title":`))
+	})
+
+	Convey("Bind multipart form with file", t, func() {
+		m := bigo.New()
+		m.Post("/", Bind(UploadForm{}), func(form UploadForm, errs Errors) {
+			So(errs.Len(), ShouldEqual, 0)
+			So(form.Title, ShouldEqual, "avatar")
+			So(form.File, ShouldNotBeNil)
+			So(form.File.Filename, ShouldEqual, "a.txt")
+		})
+
+		body := &bytes.Buffer{}
+		w := multipart.NewWriter(body)
+		w.WriteField("title", "avatar")
+		fw, err := w.CreateFormFile("file", "a.txt")
+		So(err, ShouldBeNil)
+		fw.Write([]byte("hello"))
+		w.Close()
+		performRequest(m, "POST", "/", w.FormDataContentType(), strings.NewReader(body.String()))
+	})
+
+	Convey("Pointer is not accepted as model", t, func() {
+		defer func() {
+			So(recover(), ShouldNotBeNil)
+		}()
+		m := bigo.New()
+		m.Get("/", Bind(&Post{}), func() {})
+		performRequest(m, "GET", "/", "", strings.NewReader(""))
+	})
+}
+
+func Test_Validate(t *testing.T) {
+	Convey("Validate struct by binding tags", t, func() {
+		errs := RawValidate(Post{Title: "Too long title", Email: "joe", Rating: 8, Kind: "news"})
+		So(errs.Has(ERR_MAX_SIZE), ShouldBeTrue)
+		So(errs.Has(ERR_EMAIL), ShouldBeTrue)
+		So(errs.Has(ERR_RANGE), ShouldBeTrue)
+		So(errs.Has(ERR_IN), ShouldBeTrue)
+		So(errs.Has(ERR_REQUIRED), ShouldBeTrue)
+
+		errs = RawValidate(&Post{Title: "Hello", Address: Address{"Beijing"}})
+		So(errs.Len(), ShouldEqual, 0)
+	})
+
+	Convey("Validate with custom rule", t, func() {
+		AddRule(&Rule{
+			IsMatch: func(rule string) bool {
+				return rule == "Mobile"
+			},
+			IsValid: func(errs Errors, name string, v interface{}) (bool, Errors) {
+				if s, ok := v.(string); ok && !strings.HasPrefix(s, "1") {
+					errs.Add([]string{name}, "MobileError", "Mobile")
+					return false, errs
+				}
+				return true, errs
+			},
+		})
+		type Contact struct {
+			Phone string `form:"phone" binding:"Mobile"`
+		}
+		So(RawValidate(Contact{"13800000000"}).Len(), ShouldEqual, 0)
+		So(RawValidate(Contact{"800"}).Has("MobileError"), ShouldBeTrue)
+	})
+}
@@ -24,10 +24,17 @@ type SubConfig map[string]interface{}
 
 //静态文件配置
 type StaticOpt struct {
-	Path        string `json:"Path"`        //静态目录的路径
-	Prefix      string `json:"Prefix"`      //此目录在url中的前缀，如果不设置则为/
-	SkipLogging bool   `json:"SkipLogging"` //默认在DEV,TEST模式下为false,在PROD模式下为true. 是否跳过log输出
-	IndexFile   string `json:"IndexFile"`   //如果指定，则以此文件为索引文件
+	Path         string            `json:"Path"`         //静态目录的路径
+	Prefix       string            `json:"Prefix"`       //此目录在url中的前缀，如果不设置则为/
+	SkipLogging  bool              `json:"SkipLogging"`  //默认在DEV,TEST模式下为false,在PROD模式下为true. 是否跳过log输出
+	IndexFile    string            `json:"IndexFile"`    //如果指定，则以此文件为索引文件
+	ETag         bool              `json:"ETag"`         //是否生成ETag，默认为false
+	WeakETag     bool              `json:"WeakETag"`     //是否使用由修改时间和大小生成的弱ETag，默认为false，即使用内容的SHA-1
+	CacheControl map[string]string `json:"CacheControl"` //Cache-Control头，键为路径前缀如"/img/"，后缀如".js"，或"*"表示其它文件
+	Fingerprint  bool              `json:"Fingerprint"`  //是否支持带内容哈希的文件名如app.3f9a1c0b.js，以immutable缓存，默认为false
+	FS           string            `json:"FS"`           //文件系统，为RegisterFileSystem注册的名字，或"zip:"加zip文件路径，此时Path为其中的目录，默认为空即磁盘
+	Listing      bool              `json:"Listing"`      //目录没有索引文件时是否列出目录内容，默认为false
+	ShowHidden   bool              `json:"ShowHidden"`   //列出目录内容时是否显示以.开头的隐藏文件，默认为false
 }
 
 //本地化配置
@@ -54,16 +61,86 @@ type TmplOpt struct {
 	IndentJSON      bool     `json:"IndentJSON"`      //渲染具有缩进格式的 JSON，默认为不缩进
 	IndentXML       bool     `json:"IndentXML"`       //渲染具有缩进格式的 XML，默认为不缩进
 	HTMLContentType string   `json:"HTMLContentType"` //默认为 "text/html"
+	FS              string   `json:"FS"`              //文件系统，为RegisterFileSystem注册的名字，或"zip:"加zip文件路径，此时Directory为其中的目录，默认为空即磁盘
+}
+
+//会话配置
+type SessionOpt struct {
+	Enable         bool   `json:"Enable"`         //是否开启会话,默认为false
+	Provider       string `json:"Provider"`       //会话存储方式,可选 memory,file,cookie,默认为 "memory"
+	ProviderConfig string `json:"ProviderConfig"` //存储配置,file为存放目录,默认为 "data/sessions";cookie为加密密钥,默认使用安全cookie密钥
+	CookieName     string `json:"CookieName"`     //保存会话ID的cookie名称,默认为 "BigoSession"
+	CookiePath     string `json:"CookiePath"`     //cookie路径,默认为 "/"
+	Domain         string `json:"Domain"`         //cookie域名,默认为空
+	Secure         bool   `json:"Secure"`         //是否只在https下发送cookie,默认为false
+	CookieLifeTime int    `json:"CookieLifeTime"` //cookie有效期(秒),默认为0,即浏览器关闭时失效
+	Gclifetime     int64  `json:"Gclifetime"`     //清理过期会话的间隔时间(秒),默认为3600
+	Maxlifetime    int64  `json:"Maxlifetime"`    //会话最长有效期(秒),默认与Gclifetime相同
+	IDLength       int    `json:"IDLength"`       //会话ID的随机字节长度,默认为16
+}
+
+//CSRF防护配置,需要同时开启会话
+type CSRFOpt struct {
+	Enable         bool     `json:"Enable"`         //是否开启CSRF防护,默认为false
+	Header         string   `json:"Header"`         //读取令牌的请求头名称,默认为 "X-CSRFToken"
+	Form           string   `json:"Form"`           //读取令牌的表单字段名称,默认为 "_csrf"
+	CheckOrigin    bool     `json:"CheckOrigin"`    //是否检查Origin或Referer请求头,默认为false
+	AllowedOrigins []string `json:"AllowedOrigins"` //除请求本身的Host外允许的来源域名
+	ExemptGroups   []string `json:"ExemptGroups"`   //不做CSRF检查的路由分组,如 ["/api"]
+}
+
+//跨域资源共享配置
+type CORSOpt struct {
+	Enable           bool     `json:"Enable"`           //是否开启跨域资源共享,默认为false
+	AllowOrigins     []string `json:"AllowOrigins"`     //允许的来源,可以是 "https://example.com","*.example.com" 或 "*"
+	AllowMethods     []string `json:"AllowMethods"`     //允许的请求方法,默认为请求路径上已注册的方法
+	AllowHeaders     []string `json:"AllowHeaders"`     //允许的请求头,默认为预检请求中请求的头
+	ExposeHeaders    []string `json:"ExposeHeaders"`    //允许客户端读取的响应头
+	AllowCredentials bool     `json:"AllowCredentials"` //是否允许携带cookie等凭据,默认为false
+	MaxAge           int      `json:"MaxAge"`           //预检请求结果的缓存时间(秒),默认为0,即不设置
+}
+
+//请求ID与链路追踪配置
+type TraceOpt struct {
+	Enable          bool   `json:"Enable"`          //是否开启链路追踪,开启后接收或生成请求ID,并传递W3C traceparent和tracestate,默认为false
+	RequestIDHeader string `json:"RequestIDHeader"` //读取请求ID的请求头名称,默认为 "X-Request-Id"
+	ResponseHeader  bool   `json:"ResponseHeader"`  //是否在响应头中返回请求ID,默认为false
+}
+
+//监控指标配置
+type MetricsOpt struct {
+	Enable          bool      `json:"Enable"`          //是否开启监控指标,开启后以Prometheus文本格式输出请求数,延迟,响应大小等指标,默认为false
+	Path            string    `json:"Path"`            //输出监控指标的路径,默认为 "/metrics"
+	Namespace       string    `json:"Namespace"`       //指标名称前缀,默认为 "bigo"
+	DurationBuckets []float64 `json:"DurationBuckets"` //请求延迟直方图的区间上限(秒),默认为 [0.005,0.01,0.025,0.05,0.1,0.25,0.5,1,2.5,5,10]
+}
+
+//健康检查配置
+type HealthOpt struct {
+	Enable         bool   `json:"Enable"`         //是否开启健康检查,开启后提供存活与就绪检查接口,默认为false
+	LivePath       string `json:"LivePath"`       //存活检查的路径,默认为 "/healthz"
+	ReadyPath      string `json:"ReadyPath"`      //就绪检查的路径,默认为 "/readyz",服务关闭过程中就绪检查失败
+	Timeout        int    `json:"Timeout"`        //未指定超时时间的检查项的超时时间(秒),默认为5
+	ReadinessDrain int    `json:"ReadinessDrain"` //服务关闭时就绪检查失败后继续处理请求的时间(秒),以便负载均衡先摘除实例,默认为0
+}
+
+//调试路由配置,需调用Debug挂载
+type DebugOpt struct {
+	Enable   bool   `json:"Enable"`   //是否在PROD模式下开启调试路由,其他模式下总是开启,默认为false
+	Prefix   string `json:"Prefix"`   //调试路由的前缀,默认为 "/debug"
+	User     string `json:"User"`     //访问调试路由的基本认证用户名,PROD模式下必须设置,其他模式下不设置则只允许本机访问
+	Password string `json:"Password"` //访问调试路由的基本认证密码
 }
 
 //如果以【app -c configPath】的命令行形式指定了文件，那么直接加载这个文件，否则
 //查找当前工作目录下的config.json
 //查找app所在目录下的config.json
 type Config struct {
-	AppName  string   `json:"AppName"`  //应用名称
-	WorkDir  string   `json:"WorkDir"`  //工作目录,默认为运行目录
-	LogDir   string   `json:"LogDir"`   //日志目录,默认为$WORKDIR/log
-	LogLevel LogLevel `json:"LogLevel"` //日志等级,0.none 1.info 2.debug 3.error ,默认在DEV,TEST下为1,PROD下为3
+	AppName   string   `json:"AppName"`   //应用名称
+	WorkDir   string   `json:"WorkDir"`   //工作目录,默认为运行目录
+	LogDir    string   `json:"LogDir"`    //日志目录,默认为$WORKDIR/log
+	LogLevel  LogLevel `json:"LogLevel"`  //日志等级,0.none 1.info 2.debug 3.error ,默认在DEV,TEST下为1,PROD下为3
+	LogFormat string   `json:"LogFormat"` //日志格式,text或json,默认为text
 
 	HttpAddr string `json:"HttpAddr"` //http监听地址,默认在0.0.0.0
 	HttpPort int    `json:"HttpPort"` //http监听端口,默认为3000
@@ -75,6 +152,8 @@ type Config struct {
 	EnableHttps   bool   `json:"EnableHttps"`   //是否开启https服务，默认false
 	ForceHttps    bool   `json:"ForceHttps"`    //是否强制将http请求转为https,默认为false
 
+	ShutdownTimeout int `json:"ShutdownTimeout"` //收到退出信号后等待处理中的请求完成的最长时间(秒),默认为30
+
 	EnableGzip bool `json:"EnableGzip"` //是否开启gzip,默认true,如果开启,并且客户端接受gzip的话责对会话进行gzip压缩
 	ForceGzip  bool `json:"ForceGzip"`  //是否强制开启gzip,默认false,如果开启,不管客户端接不接受,都会以gzip进行传输
 
@@ -83,6 +162,13 @@ type Config struct {
 	Statics                []StaticOpt `json:"Statics"`                //静态目录,数组
 	I18n                   *I18nOpt    `json:"i18n"`                   //本地化配置
 	Tmpl                   *TmplOpt    `json:"Tmpl"`                   //模板引擎配置
+	Session                *SessionOpt `json:"Session"`                //会话配置
+	CSRF                   *CSRFOpt    `json:"CSRF"`                   //CSRF防护配置
+	CORS                   *CORSOpt    `json:"CORS"`                   //跨域资源共享配置
+	Trace                  *TraceOpt   `json:"Trace"`                  //请求ID与链路追踪配置
+	Metrics                *MetricsOpt `json:"Metrics"`                //监控指标配置
+	Health                 *HealthOpt  `json:"Health"`                 //健康检查配置
+	Debug                  *DebugOpt   `json:"Debug"`                  //调试路由配置
 	RunMode                string      `json:"RunMode"`                //运行模式，DEV为开发模式，PROD为发布模式,TEST为测试模式
 	DevOpt                 *SubConfig  `json:"DEV"`                    //对于DEV模式下的配置，RUN_MODE为DEV时会覆盖顶级配置
 	TestOpt                *SubConfig  `json:"TEST"`                   //对于TEST模式下的配置，RUN_MODE为TEST时会覆盖顶级配置
@@ -241,10 +327,18 @@ func checkConfig(conf *Config) {
 		conf.LogLevel = lm[conf.RunMode]
 	}
 
+	if conf.LogFormat == "" {
+		conf.LogFormat = "text"
+	}
+
 	if conf.HttpPort == 0 {
 		conf.HttpPort = 3000
 	}
 
+	if conf.ShutdownTimeout <= 0 {
+		conf.ShutdownTimeout = 30
+	}
+
 	if conf.EnableHttps {
 		if conf.HttpsPort == 0 {
 			conf.HttpsPort = 443
@@ -277,6 +371,32 @@ func checkConfig(conf *Config) {
 
 	}
 
+	if conf.Session != nil && conf.Session.Enable {
+		if conf.Session.Provider == "" {
+			conf.Session.Provider = "memory"
+		}
+
+		if conf.Session.CookieName == "" {
+			conf.Session.CookieName = "BigoSession"
+		}
+
+		if conf.Session.CookiePath == "" {
+			conf.Session.CookiePath = "/"
+		}
+
+		if conf.Session.Gclifetime <= 0 {
+			conf.Session.Gclifetime = 3600
+		}
+
+		if conf.Session.Maxlifetime <= 0 {
+			conf.Session.Maxlifetime = conf.Session.Gclifetime
+		}
+
+		if conf.Session.IDLength <= 0 {
+			conf.Session.IDLength = 16
+		}
+	}
+
 	if conf.Tmpl != nil {
 		if conf.Tmpl.Directory == "" {
 			conf.Tmpl.Directory = "views"
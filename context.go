@@ -15,8 +15,6 @@
 package bigo
 
 import (
-	"crypto/md5"
-	"encoding/hex"
 	"html/template"
 	"io"
 	"io/ioutil"
@@ -27,6 +25,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fym201/bigo/utl"
@@ -82,9 +81,17 @@ type Context struct {
 	Req    Request
 	Resp   ResponseWriter
 	params Params
+	route  *Route
+	logger *Logger
 	Render // Not nil only if you use macaran.Render middleware.
 	ILocale
 	Data map[string]interface{}
+
+	// ID of current request, from X-Request-Id header or generated.
+	requestID string
+	trace     *TraceContext
+	// Whether error handlers are running, errors they respond are not handled again.
+	inErrorHandler bool
 }
 
 func (c *Context) handler() Handler {
@@ -106,6 +113,21 @@ func (c *Context) Written() bool {
 	return c.Resp.Written()
 }
 
+// Logger returns the request-scoped logger, which carries request ID, method and path.
+func (c *Context) Logger() *Logger {
+	return c.logger
+}
+
+// RequestID returns ID of current request, which is also logged as "request_id".
+func (c *Context) RequestID() string {
+	return c.requestID
+}
+
+// CurrentRoute returns the route matched by current request, it is nil when no route matches.
+func (c *Context) CurrentRoute() *Route {
+	return c.route
+}
+
 func (c *Context) run() {
 	for c.index <= len(c.handlers) {
 		vals, err := c.Invoke(c.handler())
@@ -165,6 +187,14 @@ func (ctx *Context) HTMLSet(status int, setName, tplName string, data ...interfa
 	ctx.renderHTML(status, setName, tplName, data...)
 }
 
+// Negotiate calls Render.Negotiate, data is rendered in the format chosen by Accept header.
+func (ctx *Context) Negotiate(status int, data interface{}, opts ...NegotiateOptions) {
+	if ctx.Render == nil {
+		panic("renderer middleware hasn't been registered")
+	}
+	ctx.Render.Negotiate(status, data, opts...)
+}
+
 func (ctx *Context) Redirect(location string, status ...int) {
 	code := http.StatusFound
 	if len(status) == 1 {
@@ -334,50 +364,74 @@ func (ctx *Context) GetCookieFloat64(name string) float64 {
 	return utl.Str(ctx.GetCookie(name)).MustFloat64()
 }
 
-var defaultCookieSecret string
+var defaultCookieCodec = NewCookieCodec("")
 
-// SetDefaultCookieSecret sets global default secure cookie secret.
-func (m *Bigo) SetDefaultCookieSecret(secret string) {
-	defaultCookieSecret = secret
+// SetDefaultCookieSecret sets global default secure cookie secret,
+// old secrets are still accepted when reading cookies so that they can be rotated.
+func (m *Bigo) SetDefaultCookieSecret(secret string, oldSecrets ...string) {
+	codec := NewCookieCodec(append([]string{secret}, oldSecrets...)...)
+	codec.MaxAge = defaultCookieCodec.MaxAge
+	codec.AllowLegacy = defaultCookieCodec.AllowLegacy
+	codec.Now = defaultCookieCodec.Now
+	defaultCookieCodec = codec
+}
+
+// SetCookieCodec sets global default secure cookie codec.
+func (m *Bigo) SetCookieCodec(codec *CookieCodec) {
+	defaultCookieCodec = codec
 }
 
 // SetSecureCookie sets given cookie value to response header with default secret string.
 func (ctx *Context) SetSecureCookie(name, value string, others ...interface{}) {
-	ctx.SetSuperSecureCookie(defaultCookieSecret, name, value, others...)
+	ctx.SetCodecCookie(defaultCookieCodec, name, value, others...)
 }
 
 // GetSecureCookie returns given cookie value from request header with default secret string.
 func (ctx *Context) GetSecureCookie(key string) (string, bool) {
-	return ctx.GetSuperSecureCookie(defaultCookieSecret, key)
+	return ctx.GetCodecCookie(defaultCookieCodec, key)
 }
 
-// SetSuperSecureCookie sets given cookie value to response header with secret string.
-func (ctx *Context) SetSuperSecureCookie(secret, name, value string, others ...interface{}) {
-	m := md5.Sum([]byte(secret))
-	secret = hex.EncodeToString(m[:])
-	text, err := utl.AESEncrypt([]byte(secret), []byte(value))
+// SetCodecCookie sets given cookie value to response header with given codec.
+func (ctx *Context) SetCodecCookie(codec *CookieCodec, name, value string, others ...interface{}) {
+	text, err := codec.Encode(name, value)
 	if err != nil {
 		panic("error encrypting cookie: " + err.Error())
 	}
-	ctx.SetCookie(name, hex.EncodeToString(text), others...)
+	ctx.SetCookie(name, text, others...)
 }
 
-// GetSuperSecureCookie returns given cookie value from request header with secret string.
-func (ctx *Context) GetSuperSecureCookie(secret, key string) (string, bool) {
-	val := ctx.GetCookie(key)
-	if val == "" {
-		return "", false
-	}
+// GetCodecCookie returns given cookie value from request header with given codec.
+func (ctx *Context) GetCodecCookie(codec *CookieCodec, key string) (string, bool) {
+	val, err := codec.Decode(key, ctx.GetCookie(key))
+	return val, err == nil
+}
 
-	data, err := hex.DecodeString(val)
-	if err != nil {
-		return "", false
+// secretCookieCodecs caches codecs of super secure cookie by secret,
+// so that the ciphers are not derived again for every request.
+var secretCookieCodecs sync.Map
+
+// secretCookieCodec returns codec of given secret which shares MaxAge,
+// AllowLegacy and Now with the global default secure cookie codec.
+func secretCookieCodec(secret string) *CookieCodec {
+	v, ok := secretCookieCodecs.Load(secret)
+	if !ok {
+		v, _ = secretCookieCodecs.LoadOrStore(secret, NewCookieCodec(secret))
 	}
+	codec := *v.(*CookieCodec)
+	codec.MaxAge = defaultCookieCodec.MaxAge
+	codec.AllowLegacy = defaultCookieCodec.AllowLegacy
+	codec.Now = defaultCookieCodec.Now
+	return &codec
+}
 
-	m := md5.Sum([]byte(secret))
-	secret = hex.EncodeToString(m[:])
-	text, err := utl.AESDecrypt([]byte(secret), data)
-	return string(text), err == nil
+// SetSuperSecureCookie sets given cookie value to response header with secret string.
+func (ctx *Context) SetSuperSecureCookie(secret, name, value string, others ...interface{}) {
+	ctx.SetCodecCookie(secretCookieCodec(secret), name, value, others...)
+}
+
+// GetSuperSecureCookie returns given cookie value from request header with secret string.
+func (ctx *Context) GetSuperSecureCookie(secret, key string) (string, bool) {
+	return ctx.GetCodecCookie(secretCookieCodec(secret), key)
 }
 
 // ServeContent serves given content to response.
@@ -0,0 +1,161 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package bigo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/fym201/bigo/utl"
+)
+
+const cookieCodecVersion byte = 2
+
+var (
+	ErrInvalidCookie = errors.New("cookie value is invalid or has been tampered")
+	ErrExpiredCookie = errors.New("cookie value has expired")
+)
+
+// CookieCodec encodes cookie values with AES-GCM, which both encrypts and
+// authenticates the value. The issue time is embedded in every value so that
+// it can be rejected after MaxAge.
+//
+// Multiple secrets can be given for key rotation: the first one is used to
+// encode new values and all of them are tried when decoding.
+type CookieCodec struct {
+	// Max age of values in seconds, 0 means no limit. Default is 30 days.
+	MaxAge int64
+	// Whether to accept values written by the old format, which are neither
+	// authenticated nor checked against MaxAge, so they can be forged and never
+	// expire. Only enable it for a short migration period. Default is false.
+	AllowLegacy bool
+	// Now returns the time to stamp and check values with. Default is time.Now.
+	Now func() time.Time
+
+	secrets []string
+	aeads   []cipher.AEAD
+}
+
+// NewCookieCodec creates and returns a new cookie codec with given secrets.
+func NewCookieCodec(secrets ...string) *CookieCodec {
+	if len(secrets) == 0 {
+		secrets = []string{""}
+	}
+
+	c := &CookieCodec{
+		MaxAge:  86400 * 30,
+		secrets: secrets,
+		aeads:   make([]cipher.AEAD, len(secrets)),
+	}
+	for i, secret := range secrets {
+		key := sha256.Sum256([]byte(secret))
+		block, err := aes.NewCipher(key[:])
+		if err != nil {
+			panic("cookie: " + err.Error())
+		}
+		if c.aeads[i], err = cipher.NewGCM(block); err != nil {
+			panic("cookie: " + err.Error())
+		}
+	}
+	return c
+}
+
+func (c *CookieCodec) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+// Encode encrypts and signs value with the first secret, name of cookie is
+// authenticated as well so value cannot be moved to another cookie.
+func (c *CookieCodec) Encode(name, value string) (string, error) {
+	aead := c.aeads[0]
+	buf := make([]byte, 1+aead.NonceSize())
+	buf[0] = cookieCodecVersion
+	if _, err := rand.Read(buf[1:]); err != nil {
+		return "", err
+	}
+
+	plain := make([]byte, 8+len(value))
+	binary.BigEndian.PutUint64(plain, uint64(c.now().Unix()))
+	copy(plain[8:], value)
+
+	buf = aead.Seal(buf, buf[1:], plain, []byte(name))
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hasSecret returns true if the codec encodes values with a non-empty secret.
+func (c *CookieCodec) hasSecret() bool {
+	return len(c.secrets) > 0 && len(c.secrets[0]) > 0
+}
+
+// Decode verifies and decrypts value with all secrets in order,
+// it falls back to old format if AllowLegacy is true.
+func (c *CookieCodec) Decode(name, value string) (string, error) {
+	if len(value) == 0 {
+		return "", ErrInvalidCookie
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err == nil && len(data) > 0 && data[0] == cookieCodecVersion {
+		for _, aead := range c.aeads {
+			if len(data) < 1+aead.NonceSize() {
+				break
+			}
+			plain, err := aead.Open(nil, data[1:1+aead.NonceSize()], data[1+aead.NonceSize():], []byte(name))
+			if err != nil || len(plain) < 8 {
+				continue
+			}
+
+			issued := int64(binary.BigEndian.Uint64(plain))
+			if c.MaxAge > 0 && issued+c.MaxAge < c.now().Unix() {
+				return "", ErrExpiredCookie
+			}
+			return string(plain[8:]), nil
+		}
+	}
+
+	if c.AllowLegacy {
+		for _, secret := range c.secrets {
+			if text, ok := decodeLegacyCookie(secret, value); ok {
+				return text, nil
+			}
+		}
+	}
+	return "", ErrInvalidCookie
+}
+
+// decodeLegacyCookie decrypts value written by the old secure cookie format,
+// which is AES-CFB with a key derived from MD5 of secret and no MAC.
+func decodeLegacyCookie(secret, val string) (string, bool) {
+	data, err := hex.DecodeString(val)
+	if err != nil {
+		return "", false
+	}
+
+	m := md5.Sum([]byte(secret))
+	secret = hex.EncodeToString(m[:])
+	text, err := utl.AESDecrypt([]byte(secret), data)
+	return string(text), err == nil
+}
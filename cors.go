@@ -0,0 +1,181 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package bigo
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// CORSOptions represents a struct for specifying configuration options for the CORS middleware.
+type CORSOptions struct {
+	// Origins that are allowed, an origin can be exact like "https://example.com",
+	// a wildcard subdomain like "*.example.com", or "*" for any origin.
+	AllowOrigins []string
+	// Function to decide whether an origin is allowed, it is checked after AllowOrigins.
+	AllowOriginFunc func(origin string) bool
+	// Methods that are allowed. Default is the methods registered for requested path.
+	AllowMethods []string
+	// Headers that are allowed. Default is the headers requested by preflight request.
+	AllowHeaders []string
+	// Headers that are exposed to client.
+	ExposeHeaders []string
+	// Whether to allow credentials like cookies. Default is false.
+	AllowCredentials bool
+	// How long in seconds the result of preflight request can be cached. Default is 0, which means not set.
+	MaxAge int
+}
+
+func prepareCORSOptions(options []CORSOptions) CORSOptions {
+	var opt CORSOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+
+	conf := GetConfig().CORS
+	if conf == nil {
+		conf = &CORSOpt{}
+	}
+
+	if len(opt.AllowOrigins) == 0 {
+		opt.AllowOrigins = conf.AllowOrigins
+	}
+	if len(opt.AllowMethods) == 0 {
+		opt.AllowMethods = conf.AllowMethods
+	}
+	if len(opt.AllowHeaders) == 0 {
+		opt.AllowHeaders = conf.AllowHeaders
+	}
+	if len(opt.ExposeHeaders) == 0 {
+		opt.ExposeHeaders = conf.ExposeHeaders
+	}
+	if !opt.AllowCredentials {
+		opt.AllowCredentials = conf.AllowCredentials
+	}
+	if opt.MaxAge == 0 {
+		opt.MaxAge = conf.MaxAge
+	}
+
+	for i, m := range opt.AllowMethods {
+		opt.AllowMethods[i] = strings.ToUpper(m)
+	}
+	return opt
+}
+
+// isAllowedOrigin returns true if given origin is allowed.
+func (opt *CORSOptions) isAllowedOrigin(origin string) bool {
+	host := origin
+	if u, err := url.Parse(origin); err == nil && len(u.Host) > 0 {
+		host = u.Host
+	}
+
+	for _, o := range opt.AllowOrigins {
+		switch {
+		case o == "*":
+			return true
+		case strings.HasPrefix(o, "*."):
+			if strings.HasSuffix(strings.ToLower(host), strings.ToLower(o[1:])) {
+				return true
+			}
+		case strings.EqualFold(o, origin):
+			return true
+		}
+	}
+	return opt.AllowOriginFunc != nil && opt.AllowOriginFunc(origin)
+}
+
+// isAnyOrigin returns true if any origin is allowed.
+func (opt *CORSOptions) isAnyOrigin() bool {
+	for _, o := range opt.AllowOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedMethods returns methods allowed for given request.
+func (opt *CORSOptions) allowedMethods(ctx *Context) []string {
+	if len(opt.AllowMethods) > 0 {
+		return opt.AllowMethods
+	}
+	return ctx.AllowedMethods(ctx.Req.URL.Path)
+}
+
+// CORS is a middleware that handles Cross-Origin Resource Sharing.
+// Preflight requests are answered with 204 No Content directly,
+// so they never reach the route handlers.
+func CORS(options ...CORSOptions) Handler {
+	opt := prepareCORSOptions(options)
+
+	return func(ctx *Context) {
+		origin := ctx.Req.Header.Get("Origin")
+		if len(origin) == 0 {
+			return
+		}
+
+		header := ctx.Resp.Header()
+		header.Add("Vary", "Origin")
+		if !opt.isAllowedOrigin(origin) {
+			return
+		}
+
+		preflight := ctx.Req.Method == "OPTIONS" && len(ctx.Req.Header.Get("Access-Control-Request-Method")) > 0
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+
+			method := strings.ToUpper(ctx.Req.Header.Get("Access-Control-Request-Method"))
+			methods := opt.allowedMethods(ctx)
+			allowed := false
+			for _, m := range methods {
+				if m == method {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				return
+			}
+
+			header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			if len(opt.AllowHeaders) > 0 {
+				header.Set("Access-Control-Allow-Headers", strings.Join(opt.AllowHeaders, ", "))
+			} else if reqHeaders := ctx.Req.Header.Get("Access-Control-Request-Headers"); len(reqHeaders) > 0 {
+				header.Set("Access-Control-Allow-Headers", reqHeaders)
+			}
+			if opt.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(opt.MaxAge))
+			}
+		} else if len(opt.ExposeHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(opt.ExposeHeaders, ", "))
+		}
+
+		if opt.isAnyOrigin() && !opt.AllowCredentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if opt.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			ctx.Resp.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package bigo
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// csrfSessionKey is the session key to store CSRF token.
+const csrfSessionKey = "_csrf"
+
+// CSRFOptions represents a struct for specifying configuration options for the CSRF middleware.
+type CSRFOptions struct {
+	// Name of header to read token from. Default is "X-CSRFToken".
+	Header string
+	// Name of form field to read token from. Default is "_csrf".
+	Form string
+	// Name that maps token into template variable. Default is "CsrfToken".
+	TmplName string
+	// Whether to check Origin or Referer header of unsafe requests. Default is false.
+	CheckOrigin bool
+	// Hosts that are trusted besides host of request itself, e.g. "example.com".
+	AllowedOrigins []string
+	// Patterns of route groups that skip CSRF validation, e.g. "/api".
+	ExemptGroups []string
+	// Handler for invalid requests. Default is responding 403 with error message.
+	ErrorFunc func(ctx *Context, reason string)
+}
+
+func prepareCSRFOptions(options []CSRFOptions) CSRFOptions {
+	var opt CSRFOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+
+	conf := GetConfig().CSRF
+	if conf == nil {
+		conf = &CSRFOpt{}
+	}
+
+	if len(opt.Header) == 0 {
+		opt.Header = conf.Header
+	}
+	if len(opt.Header) == 0 {
+		opt.Header = "X-CSRFToken"
+	}
+	if len(opt.Form) == 0 {
+		opt.Form = conf.Form
+	}
+	if len(opt.Form) == 0 {
+		opt.Form = "_csrf"
+	}
+	if len(opt.TmplName) == 0 {
+		opt.TmplName = "CsrfToken"
+	}
+	if !opt.CheckOrigin {
+		opt.CheckOrigin = conf.CheckOrigin
+	}
+	if len(opt.AllowedOrigins) == 0 {
+		opt.AllowedOrigins = conf.AllowedOrigins
+	}
+	if len(opt.ExemptGroups) == 0 {
+		opt.ExemptGroups = conf.ExemptGroups
+	}
+	if opt.ErrorFunc == nil {
+		opt.ErrorFunc = func(ctx *Context, reason string) {
+			http.Error(ctx.Resp, reason, http.StatusForbidden)
+		}
+	}
+
+	return opt
+}
+
+// isSafeMethod returns true if given HTTP method is not supposed to change state.
+func isSafeMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+// generateCSRFToken generates a new random token.
+func generateCSRFToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic("csrf: fail to generate token: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// isExempt returns true if current route is registered in one of exempt groups.
+func (opt *CSRFOptions) isExempt(ctx *Context) bool {
+	route := ctx.CurrentRoute()
+	if route == nil {
+		return false
+	}
+	for _, g := range route.Groups() {
+		for _, exempt := range opt.ExemptGroups {
+			if g == exempt {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isAllowedOrigin returns true if Origin or Referer header of request is trusted,
+// requests without both headers are allowed and rely on token only.
+func (opt *CSRFOptions) isAllowedOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if len(origin) == 0 {
+		origin = req.Header.Get("Referer")
+	}
+	if len(origin) == 0 {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || len(u.Host) == 0 {
+		return false
+	}
+	if strings.EqualFold(u.Host, req.Host) {
+		return true
+	}
+	for _, host := range opt.AllowedOrigins {
+		if strings.EqualFold(u.Host, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// CSRF is a middleware that protects unsafe requests against cross-site request forgery.
+// It issues a token per session, so Sessioner must be used before it. The token is
+// available in templates through template variable and function "csrf_field", and
+// must be sent back by header or form field for requests other than GET, HEAD, OPTIONS and TRACE.
+func CSRF(options ...CSRFOptions) Handler {
+	opt := prepareCSRFOptions(options)
+
+	return func(ctx *Context, sess Session) {
+		token, _ := sess.Get(csrfSessionKey).(string)
+		if len(token) == 0 {
+			token = generateCSRFToken()
+			sess.Set(csrfSessionKey, token)
+		}
+
+		ctx.Data[opt.TmplName] = token
+		ctx.Data["CsrfField"] = template.HTML(`<input type="hidden" name="` +
+			template.HTMLEscapeString(opt.Form) + `" value="` + token + `">`)
+
+		if isSafeMethod(ctx.Req.Method) || opt.isExempt(ctx) {
+			return
+		}
+
+		if opt.CheckOrigin && !opt.isAllowedOrigin(ctx.Req.Request) {
+			opt.ErrorFunc(ctx, "Invalid origin of request.")
+			return
+		}
+
+		sent := ctx.Req.Header.Get(opt.Header)
+		if len(sent) == 0 {
+			sent = ctx.Req.FormValue(opt.Form)
+		}
+		if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+			opt.ErrorFunc(ctx, "Invalid csrf token.")
+			return
+		}
+	}
+}
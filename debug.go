@@ -0,0 +1,149 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package bigo
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	rpprof "runtime/pprof"
+	"strings"
+)
+
+// DebugOptions represents a struct for specifying configuration options for debug routes.
+type DebugOptions struct {
+	// Prefix of debug routes. Default is "/debug".
+	Prefix string
+	// Auth guards debug routes, it must respond when access is denied. Default is basic auth
+	// of User and Password if they are set, otherwise only direct requests from loopback
+	// addresses are allowed.
+	Auth Handler
+	// User and Password of basic auth.
+	User     string
+	Password string
+	// Whether to mount debug routes in production mode. Default is false.
+	Enable bool
+}
+
+func prepareDebugOptions(options []DebugOptions) DebugOptions {
+	var opt DebugOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+
+	conf := GetConfig().Debug
+	if conf == nil {
+		conf = &DebugOpt{}
+	}
+
+	if len(opt.Prefix) == 0 {
+		opt.Prefix = conf.Prefix
+	}
+	if len(opt.Prefix) == 0 {
+		opt.Prefix = "/debug"
+	}
+	opt.Prefix = "/" + strings.Trim(opt.Prefix, "/")
+	if len(opt.User) == 0 {
+		opt.User, opt.Password = conf.User, conf.Password
+	}
+	if !opt.Enable {
+		opt.Enable = conf.Enable
+	}
+	if opt.Auth == nil && len(opt.User) > 0 {
+		opt.Auth = basicAuth(opt.User, opt.Password)
+	}
+	return opt
+}
+
+// basicAuth returns a handler that responds 401 unless request has given credentials.
+func basicAuth(user, password string) Handler {
+	return func(ctx *Context) {
+		u, p, ok := ctx.Req.BasicAuth()
+		if ok && subtle.ConstantTimeCompare([]byte(u), []byte(user)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1 {
+			return
+		}
+		ctx.Resp.Header().Set("WWW-Authenticate", `Basic realm="debug"`)
+		http.Error(ctx.Resp, "401 unauthorized", http.StatusUnauthorized)
+	}
+}
+
+// loopbackOnly returns a handler that responds 403 unless request comes from a loopback address
+// directly, requests forwarded by proxies are rejected since their origin is unknown.
+func loopbackOnly() Handler {
+	return func(ctx *Context) {
+		host, _, err := net.SplitHostPort(ctx.Req.RemoteAddr)
+		ip := net.ParseIP(host)
+		if err == nil && ip != nil && ip.IsLoopback() && len(ctx.Req.Header.Get("Forwarded")) == 0 &&
+			len(ctx.Req.Header.Get("X-Forwarded-For")) == 0 && len(ctx.Req.Header.Get("X-Real-IP")) == 0 {
+			return
+		}
+		http.Error(ctx.Resp, "403 forbidden", http.StatusForbidden)
+	}
+}
+
+// Debug mounts debug routes under prefix:
+//
+//	/pprof/          index of profiles, and profiles like /pprof/heap by net/http/pprof
+//	/vars            variables of expvar in JSON
+//	/goroutines      stack traces of all goroutines in text
+//	/routes          registered routes with method, pattern and number of handlers in JSON
+//
+// Routes are guarded by Auth handler, or only allowed from loopback addresses without Auth and User.
+// It does nothing in production mode unless enabled by options or config, where Auth or User is required.
+func (r *Router) Debug(opts ...DebugOptions) {
+	opt := prepareDebugOptions(opts)
+	if Env == Prod && !opt.Enable {
+		return
+	}
+	if opt.Auth == nil {
+		if Env == Prod {
+			panic("debug routes require Auth or User in production mode")
+		}
+		opt.Auth = loopbackOnly()
+	}
+
+	r.Group(opt.Prefix, func() {
+		r.Get("/pprof/", pprof.Index)
+		r.Get("/pprof/cmdline", pprof.Cmdline)
+		r.Get("/pprof/profile", pprof.Profile)
+		r.Any("/pprof/symbol", pprof.Symbol)
+		r.Get("/pprof/trace", pprof.Trace)
+		r.Get("/pprof/:name", func(ctx *Context) {
+			name := ctx.Params(":name")
+			if rpprof.Lookup(name) == nil {
+				http.NotFound(ctx.Resp, ctx.Req.Request)
+				return
+			}
+			pprof.Handler(name).ServeHTTP(ctx.Resp, ctx.Req.Request)
+		})
+		r.Get("/vars", expvar.Handler().ServeHTTP)
+		r.Get("/goroutines", func(ctx *Context) {
+			ctx.Resp.Header().Set(ContentType, CONTENT_PLAIN+"; charset="+defaultCharset)
+			ctx.Resp.WriteHeader(http.StatusOK)
+			// Debug level 2 prints stacks in the same format as an unrecovered panic.
+			rpprof.Lookup("goroutine").WriteTo(ctx.Resp, 2)
+		})
+		r.Get("/routes", func(ctx *Context) {
+			writeJSON(ctx, ctx.Resp, http.StatusOK, map[string]interface{}{
+				"routes":     r.Routes(),
+				"goroutines": runtime.NumGoroutine(),
+			})
+		})
+	}, opt.Auth)
+}
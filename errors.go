@@ -0,0 +1,160 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package bigo
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+)
+
+// HTTPError is an error with HTTP status code, its message is shown to clients.
+type HTTPError struct {
+	Status  int
+	Message string
+	// Err is the underlying error, which is logged but not shown to clients.
+	Err error
+}
+
+// NewHTTPError returns a HTTPError of given status, message defaults to status text.
+func NewHTTPError(status int, message ...string) *HTTPError {
+	e := &HTTPError{Status: status}
+	if len(message) > 0 {
+		e.Message = message[0]
+	} else {
+		e.Message = http.StatusText(status)
+	}
+	return e
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// StatusOf returns HTTP status of error, which is the status of HTTPError or
+// StatusCode() of error implements it, otherwise 500.
+func StatusOf(err error) int {
+	var he *HTTPError
+	if errors.As(err, &he) {
+		return he.Status
+	}
+	var sc interface{ StatusCode() int }
+	if errors.As(err, &sc) {
+		return sc.StatusCode()
+	}
+	return http.StatusInternalServerError
+}
+
+// ErrorHandler registers handlers to respond errors of given status, which are invoked from
+// panics, unmatched routes, errors returned by handlers, Context.HandleError and Render.Error. Status 0 registers
+// handlers for statuses without their own. Handlers can read "Status", "StatusText", "Error"
+// and "RequestID" from Context.Data, the error is mapped as error if there is one.
+// Without handlers, errors are responded in plain text.
+func (m *Bigo) ErrorHandler(status int, handlers ...Handler) {
+	validateHandlers(handlers)
+	if m.errorHandlers == nil {
+		m.errorHandlers = make(map[int][]Handler)
+	}
+	m.errorHandlers[status] = handlers
+}
+
+// ErrorHTML returns an error handler that renders template of given name with Context.Data.
+func ErrorHTML(name string) Handler {
+	return func(ctx *Context) {
+		status, _ := ctx.Data["Status"].(int)
+		ctx.HTML(status, name)
+	}
+}
+
+// ErrorJSON returns an error handler that responds status, error message and request ID in JSON.
+func ErrorJSON() Handler {
+	return func(ctx *Context) {
+		status, _ := ctx.Data["Status"].(int)
+		writeJSON(ctx, ctx.Resp, status, map[string]interface{}{
+			"status":     status,
+			"error":      ctx.Data["Error"],
+			"request_id": ctx.Data["RequestID"],
+		})
+	}
+}
+
+// HandleError responds error of given status by registered error handlers, or in plain text
+// if there is none, err can be nil. Message of HTTPError is shown to clients, messages of
+// other errors are not.
+func (ctx *Context) HandleError(status int, err error) {
+	if !ctx.runErrorHandler(status, err) {
+		http.Error(ctx.Resp, ctx.Data["Error"].(string), status)
+	}
+}
+
+// runErrorHandler prepares data of error and runs registered error handlers,
+// it returns false if there is no handler for the status, or it is called by the handlers.
+func (ctx *Context) runErrorHandler(status int, err error) bool {
+	if ctx.inErrorHandler {
+		return false
+	}
+	message := http.StatusText(status)
+	var he *HTTPError
+	if errors.As(err, &he) {
+		message = he.Message
+	}
+	if status >= 500 && err != nil && ctx.logger != nil {
+		ctx.logger.Error("request failed", "status", status, "error", err)
+	}
+
+	ctx.Data["Status"] = status
+	ctx.Data["StatusText"] = http.StatusText(status)
+	ctx.Data["Error"] = message
+	ctx.Data["RequestID"] = ctx.RequestID()
+	if err != nil {
+		ctx.MapTo(err, (*error)(nil))
+	}
+
+	if ctx.Router == nil || ctx.Router.m == nil {
+		return false
+	}
+	handlers, ok := ctx.Router.m.errorHandlers[status]
+	if !ok {
+		if handlers, ok = ctx.Router.m.errorHandlers[0]; !ok {
+			return false
+		}
+	}
+
+	ctx.inErrorHandler = true
+	defer func() {
+		ctx.inErrorHandler = false
+	}()
+	for _, h := range handlers {
+		vals, err := ctx.Invoke(h)
+		if err != nil {
+			panic(err)
+		}
+		if len(vals) > 0 {
+			ev := ctx.GetVal(reflect.TypeOf(ReturnHandler(nil)))
+			ev.Interface().(ReturnHandler)(ctx, vals)
+		}
+		if ctx.Written() {
+			break
+		}
+	}
+	return true
+}
@@ -0,0 +1,195 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package bigo
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// zipFS is a fs.FS backed by zip archive. Files are read into memory when they are opened,
+// so that they are seekable as http.ServeContent requires.
+type zipFS struct {
+	r *zip.Reader
+}
+
+// NewZipFS returns a fs.FS backed by given zip archive.
+func NewZipFS(r *zip.Reader) fs.FS {
+	return zipFS{r}
+}
+
+// OpenZipFS reads zip archive of given path and returns a fs.FS backed by it.
+func OpenZipFS(name string) (fs.FS, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	return NewZipFS(r), nil
+}
+
+func (z zipFS) Open(name string) (fs.File, error) {
+	f, err := z.r.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if fi.IsDir() {
+		return f, nil
+	}
+
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return &memFile{bytes.NewReader(data), fi}, nil
+}
+
+// memFile is a file read into memory.
+type memFile struct {
+	*bytes.Reader
+	fi fs.FileInfo
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	return f.fi, nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+// StaticFS returns a http.FileSystem of given directory in fsys for StaticOptions.FileSystem,
+// e.g. StaticFS(embedFS, "public"). Files of fsys must be seekable, which embed.FS is.
+func StaticFS(fsys fs.FS, dir string) http.FileSystem {
+	sub, err := subFS(fsys, dir)
+	if err != nil {
+		panic("StaticFS: " + err.Error())
+	}
+	return ioFileSystem{http.FS(sub)}
+}
+
+// ioFileSystem makes empty name refer the root like http.Dir does.
+type ioFileSystem struct {
+	http.FileSystem
+}
+
+func (fs ioFileSystem) Open(name string) (http.File, error) {
+	if len(name) == 0 {
+		name = "/"
+	}
+	return fs.FileSystem.Open(name)
+}
+
+// subFS returns sub tree of fsys by directory, empty directory means the root.
+func subFS(fsys fs.FS, dir string) (fs.FS, error) {
+	dir = strings.Trim(path.Clean("/"+filepath.ToSlash(dir)), "/")
+	if len(dir) == 0 {
+		return fsys, nil
+	}
+	return fs.Sub(fsys, dir)
+}
+
+// NewTemplateFileSystemFS creates new template file system with templates in opt.Directory of fsys.
+func NewTemplateFileSystemFS(fsys fs.FS, opt RenderOptions, omitData bool) TplFileSystem {
+	tfs := TplFileSystem{}
+	tfs.files = make([]TemplateFile, 0, 10)
+
+	sub, err := subFS(fsys, opt.Directory)
+	if err != nil {
+		panic("NewTemplateFileSystemFS: " + err.Error())
+	}
+
+	if err = fs.WalkDir(sub, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		ext := GetExt(p)
+
+		for _, extension := range opt.Extensions {
+			if ext == extension {
+				var data []byte
+				if !omitData {
+					data, err = fs.ReadFile(sub, p)
+					if err != nil {
+						return err
+					}
+				}
+
+				name := p[0 : len(p)-len(ext)]
+				tfs.files = append(tfs.files, NewTplFile(name, data, ext))
+				break
+			}
+		}
+
+		return nil
+	}); err != nil {
+		panic("NewTemplateFileSystemFS: " + err.Error())
+	}
+
+	return tfs
+}
+
+var fileSystems = struct {
+	lock sync.RWMutex
+	m    map[string]fs.FS
+}{m: make(map[string]fs.FS)}
+
+// RegisterFileSystem registers a file system like embed.FS by name,
+// so that statics and templates in config can refer it by "FS".
+func RegisterFileSystem(name string, fsys fs.FS) {
+	fileSystems.lock.Lock()
+	defer fileSystems.lock.Unlock()
+
+	fileSystems.m[name] = fsys
+}
+
+// GetFileSystem returns file system registered by name. Name with "zip:" prefix
+// is the path of a zip archive, relative path is relative to Root.
+func GetFileSystem(name string) (fs.FS, error) {
+	if strings.HasPrefix(name, "zip:") {
+		p := name[len("zip:"):]
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(Root, p)
+		}
+		return OpenZipFS(p)
+	}
+
+	fileSystems.lock.RLock()
+	defer fileSystems.lock.RUnlock()
+
+	fsys, ok := fileSystems.m[name]
+	if !ok {
+		return nil, fmt.Errorf("file system %q is not registered", name)
+	}
+	return fsys, nil
+}
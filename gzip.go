@@ -21,7 +21,6 @@ import (
 	"fmt"
 	"net"
 	"net/http"
-	"strings"
 )
 
 const (
@@ -38,7 +37,7 @@ const (
 func Gziper() Handler {
 	return func(ctx *Context) {
 
-		if !GetConfig().ForceGzip && !strings.Contains(ctx.Req.Header.Get(HeaderAcceptEncoding), "gzip") {
+		if !GetConfig().ForceGzip && !acceptsEncoding(ctx.Req.Header.Get(HeaderAcceptEncoding), "gzip") {
 			return
 		}
 
@@ -47,25 +46,53 @@ func Gziper() Handler {
 		headers.Set(HeaderVary, HeaderAcceptEncoding)
 
 		gz := gzip.NewWriter(ctx.Resp)
-		defer gz.Close()
+		gzw := &gzipResponseWriter{gz, ctx.Resp, false}
+		defer func() {
+			if !gzw.raw {
+				gz.Close()
+			}
+		}()
 
-		gzw := gzipResponseWriter{gz, ctx.Resp}
 		ctx.Resp = gzw
 		ctx.MapTo(gzw, (*http.ResponseWriter)(nil))
 
 		ctx.Next()
 
 		// delete content length after we know we have been written to
-		gzw.Header().Del(HeaderContentLength)
+		if !gzw.raw {
+			gzw.Header().Del(HeaderContentLength)
+		}
 	}
 }
 
 type gzipResponseWriter struct {
 	w *gzip.Writer
 	ResponseWriter
+	// raw is true when body is already encoded and written as it is.
+	raw bool
+}
+
+// skipGzip makes Gziper write body of current response as it is,
+// it is used when body is already encoded, e.g. precompressed static files.
+func skipGzip(ctx *Context) {
+	w := ctx.Resp
+	for {
+		switch t := w.(type) {
+		case *gzipResponseWriter:
+			t.raw = true
+			return
+		case *minifyResponseWriter:
+			w = t.ResponseWriter
+		default:
+			return
+		}
+	}
 }
 
-func (grw gzipResponseWriter) Write(p []byte) (int, error) {
+func (grw *gzipResponseWriter) Write(p []byte) (int, error) {
+	if grw.raw {
+		return grw.ResponseWriter.Write(p)
+	}
 	if len(grw.Header().Get(HeaderContentType)) == 0 {
 		grw.Header().Set(HeaderContentType, http.DetectContentType(p))
 	}
@@ -73,7 +100,7 @@ func (grw gzipResponseWriter) Write(p []byte) (int, error) {
 	return grw.w.Write(p)
 }
 
-func (grw gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+func (grw *gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	hijacker, ok := grw.ResponseWriter.(http.Hijacker)
 	if !ok {
 		return nil, nil, fmt.Errorf("the ResponseWriter doesn't support the Hijacker interface")
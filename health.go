@@ -0,0 +1,253 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package bigo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthCheckFunc checks whether a component is healthy, ctx is done when the check times out.
+type HealthCheckFunc func(ctx context.Context) error
+
+type healthCheck struct {
+	name     string
+	timeout  time.Duration
+	liveness bool
+	fn       HealthCheckFunc
+}
+
+// HealthCheckResult is the result of a check.
+type HealthCheckResult struct {
+	Name string `json:"name"`
+	// Status is "ok", "fail" or "timeout".
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Latency of the check in milliseconds.
+	Latency float64 `json:"latency_ms"`
+}
+
+// HealthReport is the aggregated result of checks.
+type HealthReport struct {
+	// Status is "ok" if all checks pass, otherwise "fail".
+	Status string              `json:"status"`
+	Checks []HealthCheckResult `json:"checks"`
+}
+
+// HealthRegistry holds named checks of components.
+type HealthRegistry struct {
+	lock   sync.RWMutex
+	checks []*healthCheck
+}
+
+// DefaultHealth is the registry used by Health middleware by default,
+// Renderer and I18n register their checks in it.
+var DefaultHealth = NewHealthRegistry()
+
+func NewHealthRegistry() *HealthRegistry {
+	return &HealthRegistry{}
+}
+
+func (h *HealthRegistry) register(c *healthCheck) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for i, old := range h.checks {
+		if old.name == c.name {
+			h.checks[i] = c
+			return
+		}
+	}
+	h.checks = append(h.checks, c)
+}
+
+// Register registers or replaces a readiness check by name, timeout 0 means the default
+// timeout of Health middleware. Readiness checks decide whether to send traffic to the server.
+func (h *HealthRegistry) Register(name string, timeout time.Duration, fn HealthCheckFunc) {
+	h.register(&healthCheck{name, timeout, false, fn})
+}
+
+// RegisterLiveness registers or replaces a liveness check by name, which is also a readiness check.
+// Liveness checks decide whether the server should be restarted, so keep them cheap and local.
+func (h *HealthRegistry) RegisterLiveness(name string, timeout time.Duration, fn HealthCheckFunc) {
+	h.register(&healthCheck{name, timeout, true, fn})
+}
+
+// Unregister removes check of given name.
+func (h *HealthRegistry) Unregister(name string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for i, c := range h.checks {
+		if c.name == name {
+			h.checks = append(h.checks[:i], h.checks[i+1:]...)
+			return
+		}
+	}
+}
+
+// Run runs liveness checks, or all checks for readiness, concurrently, timeout applies to
+// checks without their own. Results are in order of registration.
+func (h *HealthRegistry) Run(readiness bool, timeout time.Duration) HealthReport {
+	h.lock.RLock()
+	checks := make([]*healthCheck, 0, len(h.checks))
+	for _, c := range h.checks {
+		if readiness || c.liveness {
+			checks = append(checks, c)
+		}
+	}
+	h.lock.RUnlock()
+
+	report := HealthReport{Status: "ok", Checks: make([]HealthCheckResult, len(checks))}
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *healthCheck) {
+			defer wg.Done()
+			report.Checks[i] = c.run(timeout)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, r := range report.Checks {
+		if r.Status != "ok" {
+			report.Status = "fail"
+		}
+	}
+	return report
+}
+
+// run runs check with timeout, the check keeps running in background if it times out.
+func (c *healthCheck) run(timeout time.Duration) HealthCheckResult {
+	if c.timeout > 0 {
+		timeout = c.timeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if e := recover(); e != nil {
+				done <- fmt.Errorf("panic: %v", e)
+			}
+		}()
+		done <- c.fn(ctx)
+	}()
+
+	r := HealthCheckResult{Name: c.name, Status: "ok"}
+	select {
+	case err := <-done:
+		if err != nil {
+			r.Status, r.Error = "fail", err.Error()
+		}
+	case <-ctx.Done():
+		r.Status, r.Error = "timeout", "check did not finish in "+timeout.String()
+	}
+	r.Latency = float64(time.Since(start).Microseconds()) / 1000
+	return r
+}
+
+// HealthOptions represents a struct for specifying configuration options for the Health middleware.
+type HealthOptions struct {
+	// Registry of checks. Default is DefaultHealth.
+	Registry *HealthRegistry
+	// Path of liveness endpoint. Default is "/healthz".
+	LivePath string
+	// Path of readiness endpoint. Default is "/readyz".
+	ReadyPath string
+	// Timeout of checks without their own. Default is 5 seconds.
+	Timeout time.Duration
+}
+
+func prepareHealthOptions(options []HealthOptions) HealthOptions {
+	var opt HealthOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+
+	conf := GetConfig().Health
+	if conf == nil {
+		conf = &HealthOpt{}
+	}
+
+	if opt.Registry == nil {
+		opt.Registry = DefaultHealth
+	}
+	if len(opt.LivePath) == 0 {
+		opt.LivePath = conf.LivePath
+	}
+	if len(opt.LivePath) == 0 {
+		opt.LivePath = "/healthz"
+	}
+	if len(opt.ReadyPath) == 0 {
+		opt.ReadyPath = conf.ReadyPath
+	}
+	if len(opt.ReadyPath) == 0 {
+		opt.ReadyPath = "/readyz"
+	}
+	if opt.Timeout == 0 {
+		opt.Timeout = time.Duration(conf.Timeout) * time.Second
+	}
+	if opt.Timeout == 0 {
+		opt.Timeout = 5 * time.Second
+	}
+	return opt
+}
+
+// Health returns a middleware that serves liveness and readiness endpoints, which respond
+// aggregated results of checks in JSON, with status 200 if all checks pass, otherwise 503.
+// Readiness fails once the server is shutting down. Put it before other middlewares.
+func Health(opts ...HealthOptions) Handler {
+	opt := prepareHealthOptions(opts)
+
+	return func(ctx *Context) {
+		path := ctx.Req.URL.Path
+		if (path != opt.LivePath && path != opt.ReadyPath) ||
+			(ctx.Req.Method != "GET" && ctx.Req.Method != "HEAD") {
+			return
+		}
+
+		readiness := path == opt.ReadyPath
+		report := opt.Registry.Run(readiness, opt.Timeout)
+		if readiness && ctx.Router != nil && ctx.Router.m != nil && ctx.Router.m.IsShuttingDown() {
+			report.Status = "fail"
+			report.Checks = append(report.Checks, HealthCheckResult{
+				Name:   "shutdown",
+				Status: "fail",
+				Error:  "server is shutting down",
+			})
+		}
+
+		status := http.StatusOK
+		if report.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+		data, err := json.Marshal(report)
+		if err != nil {
+			http.Error(ctx.Resp, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ctx.Resp.Header().Set(ContentType, ContentJSON+"; charset="+defaultCharset)
+		ctx.Resp.Header().Set("Cache-Control", "no-store")
+		ctx.Resp.WriteHeader(status)
+		ctx.Resp.Write(data)
+	}
+}
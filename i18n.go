@@ -15,6 +15,7 @@
 package bigo
 
 import (
+	"context"
 	"fmt"
 	"path"
 	"strings"
@@ -41,6 +42,19 @@ func initLocales(opt I18nOptions) {
 	}
 }
 
+// checkLocales returns error if any language is not loaded or its locale file is missing.
+func checkLocales(opt I18nOptions) error {
+	for _, lang := range opt.Langs {
+		if !i18n.IsExist(lang) {
+			return fmt.Errorf("language %s is not loaded", lang)
+		}
+		if fname := path.Join(opt.Directory, fmt.Sprintf(opt.Format, lang)); !utl.IsFile(fname) {
+			return fmt.Errorf("locale file %s does not exist", fname)
+		}
+	}
+	return nil
+}
+
 // A Locale describles the information of localization.
 type Locale struct {
 	i18n.Locale
@@ -129,6 +143,9 @@ type LangType struct {
 func I18n(options ...I18nOptions) Handler {
 	opt := prepareI18nOptions(options)
 	initLocales(opt)
+	DefaultHealth.Register("i18n", 0, func(context.Context) error {
+		return checkLocales(opt)
+	})
 	return func(ctx *Context) {
 		isNeedRedir := false
 		hasCookie := false
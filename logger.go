@@ -16,14 +16,18 @@
 package bigo
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"reflect"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/fym201/bigo/utl"
@@ -35,39 +39,56 @@ func init() {
 	ColorLog = runtime.GOOS != "windows"
 }
 
-// Logger returns a middleware handler that logs the request as it goes in and the response as it goes out.
+// ReqLogger returns a middleware handler that logs the request as it goes in and the response as it goes out.
+// Both lines are written by the request logger, so they carry request ID, method and path.
 func ReqLogger() Handler {
 	return func(ctx *Context, log *Logger) {
 		start := time.Now()
 
-		log.LogInfo("Started %s %s for %s", ctx.Req.Method, ctx.Req.RequestURI, ctx.RemoteAddr())
+		log.Info("Started "+ctx.Req.Method+" "+ctx.Req.RequestURI, "remote", ctx.RemoteAddr())
 
 		rw := ctx.Resp.(ResponseWriter)
 		ctx.Next()
 
-		content := fmt.Sprintf("Completed %s %v %s in %v", ctx.Req.RequestURI, rw.Status(), http.StatusText(rw.Status()), time.Since(start))
-		if ColorLog {
-			switch rw.Status() {
-			case 200, 201, 202:
-				content = fmt.Sprintf("\033[1;32m[INFO] %s\033[0m", content)
-			case 301, 302:
-				content = fmt.Sprintf("\033[1;37m[INFO] %s\033[0m", content)
-			case 304:
-				content = fmt.Sprintf("\033[1;33m[INFO] %s\033[0m", content)
-			case 401, 403:
-				content = fmt.Sprintf("\033[4;31m[INFO] %s\033[0m", content)
-			case 404:
-				content = fmt.Sprintf("\033[1;31m[INFO] %s\033[0m", content)
-			case 500:
-				content = fmt.Sprintf("\033[1;36m[INFO] %s\033[0m", content)
-			}
-		} else {
-			content = fmt.Sprintf("[INFO] %s", content)
+		// Nothing written means net/http will respond 200.
+		status := rw.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := LogLevelInfo
+		if status >= 500 {
+			level = LogLevelError
 		}
-		log.Println(content)
+		color, ok := statusLogColors[status]
+		if !ok {
+			color = logLevelColors[level]
+		}
+		log.logw(level, color, fmt.Sprintf("Completed %s %v %s", ctx.Req.RequestURI, status, http.StatusText(status)),
+			"status", status, "latency", time.Since(start))
 	}
 }
 
+//文本格式且ColorLog时,请求完成日志按响应状态码着色
+var statusLogColors = map[int]string{
+	200: "1;32",
+	201: "1;32",
+	202: "1;32",
+	301: "1;37",
+	302: "1;37",
+	304: "1;33",
+	401: "4;31",
+	403: "4;31",
+	404: "1;31",
+	500: "1;36",
+}
+
+//生成请求ID,用于在日志中关联同一请求的多条记录
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 var _defaultLoggerWriter io.Writer
 var _defaultLogger *Logger
 
@@ -130,14 +151,32 @@ func (log *LoggerWriter) Write(p []byte) (n int, err error) {
 
 }
 
+//日志格式
+type LogFormat int
+
+const (
+	LogFormatText LogFormat = iota //文本格式,如 [INFO] message key=value
+	LogFormatJSON                  //JSON格式,每行一个JSON对象
+)
+
 //日志输出器
 type Logger struct {
 	*log.Logger
+	level  *LogLevel
+	format *LogFormat
+	fields []interface{} //键值对,由With添加
 }
 
+//创建日志输出器,日志级别和格式默认使用配置中的LogLevel和LogFormat
 func NewLogger(out io.Writer, prefix string, flag int) *Logger {
-	logger := Logger{log.New(out, prefix, flag)}
-	return &logger
+	conf := GetConfig()
+	level, format := conf.LogLevel, LogFormatText
+	if conf.LogFormat == "json" {
+		format = LogFormatJSON
+	}
+	logger := &Logger{Logger: log.New(out, prefix, flag), level: &level, format: &format}
+	logger.SetFormat(format)
+	return logger
 }
 
 //默认日志输出器
@@ -148,42 +187,162 @@ func DefaultLogger() *Logger {
 	return _defaultLogger
 }
 
-//输出日志，level为日志级别
-func (l *Logger) Log(level LogLevel, a ...interface{}) {
-	alen := len(a)
-	if alen == 0 || (l == _defaultLogger && level < GetConfig().LogLevel) {
+//设置日志级别,低于此级别的日志不会输出,LogLevelNone则不输出任何日志,对With派生的日志输出器同样有效
+func (l *Logger) SetLevel(level LogLevel) {
+	*l.level = level
+}
+
+//返回日志级别
+func (l *Logger) Level() LogLevel {
+	return *l.level
+}
+
+//设置日志格式,JSON格式下不再输出前缀和标准库log的时间等信息,而是输出time字段
+func (l *Logger) SetFormat(format LogFormat) {
+	*l.format = format
+	if format == LogFormatJSON {
+		l.SetPrefix("")
+		l.SetFlags(0)
+	}
+}
+
+//返回一个附带了键值对的日志输出器,fields依次为键和值,键应为字符串
+func (l *Logger) With(fields ...interface{}) *Logger {
+	if len(fields)%2 != 0 {
+		fields = append(fields, "")
+	}
+	child := *l
+	child.fields = make([]interface{}, 0, len(l.fields)+len(fields))
+	child.fields = append(child.fields, l.fields...)
+	child.fields = append(child.fields, fields...)
+	return &child
+}
+
+//返回给定级别的日志是否会输出
+func (l *Logger) Enabled(level LogLevel) bool {
+	return *l.level != LogLevelNone && level >= *l.level
+}
+
+var logLevelNames = map[LogLevel]string{
+	LogLevelInfo:  "INFO",
+	LogLevelDebug: "DEBUG",
+	LogLevelError: "ERROR",
+}
+
+var logLevelColors = map[LogLevel]string{
+	LogLevelInfo:  "1;32",
+	LogLevelDebug: "1;37",
+	LogLevelError: "1;31",
+}
+
+//输出带键值对的日志,fields依次为键和值
+func (l *Logger) Logw(level LogLevel, msg string, fields ...interface{}) {
+	l.logw(level, logLevelColors[level], msg, fields...)
+}
+
+//输出带键值对的日志,文本格式且ColorLog时使用color着色
+func (l *Logger) logw(level LogLevel, color, msg string, fields ...interface{}) {
+	if !l.Enabled(level) {
 		return
 	}
+	if len(fields)%2 != 0 {
+		fields = append(fields, "")
+	}
+	fields = append(l.fields[:len(l.fields):len(l.fields)], fields...)
 
-	var content string
+	if *l.format == LogFormatJSON {
+		l.Println(encodeJSONLog(level, msg, fields))
+		return
+	}
 
-	if reflect.TypeOf(a[0]).Kind() == reflect.String {
-		content = fmt.Sprintf(a[0].(string), a[1:]...)
-	} else {
-		content = fmt.Sprint(a...)
+	buf := bytes.NewBufferString(msg)
+	for i := 0; i < len(fields); i += 2 {
+		fmt.Fprintf(buf, " %v=", fields[i])
+		switch v := fields[i+1].(type) {
+		case string:
+			if strings.ContainsAny(v, " \t\"=") || len(v) == 0 {
+				fmt.Fprintf(buf, "%q", v)
+			} else {
+				buf.WriteString(v)
+			}
+		case error:
+			fmt.Fprintf(buf, "%q", v.Error())
+		default:
+			fmt.Fprint(buf, v)
+		}
 	}
 
+	content := buf.String()
 	if ColorLog {
-		switch level {
-		case LogLevelInfo:
-			content = fmt.Sprintf("\033[1;32m[INFO] %s\033[0m", content)
-		case LogLevelDebug:
-			content = fmt.Sprintf("\033[1;37m[DEBUG] %s\033[0m", content)
-		case LogLevelError:
-			content = fmt.Sprintf("\033[1;31m[ERROR] %s\033[0m", content)
-		}
+		content = fmt.Sprintf("\033[%sm[%s] %s\033[0m", color, logLevelNames[level], content)
 	} else {
-		switch level {
-		case LogLevelInfo:
-			content = fmt.Sprintf("[INFO] %s", content)
-		case LogLevelDebug:
-			content = fmt.Sprintf("[DEBUG] %s", content)
-		case LogLevelError:
-			content = fmt.Sprintf("[ERROR] %s", content)
+		content = fmt.Sprintf("[%s] %s", logLevelNames[level], content)
+	}
+	l.Println(content)
+}
+
+//将日志编码为一行JSON,固定包含time,level,msg字段
+func encodeJSONLog(level LogLevel, msg string, fields []interface{}) string {
+	buf := bytes.NewBufferString("{")
+	write := func(key string, val interface{}) {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+
+		switch v := val.(type) {
+		case error:
+			val = v.Error()
+		case fmt.Stringer:
+			val = v.String()
 		}
+		b, err := json.Marshal(val)
+		if err != nil {
+			b, _ = json.Marshal(fmt.Sprint(val))
+		}
+		buf.Write(b)
 	}
 
-	l.Println(content)
+	write("time", time.Now().Format(time.RFC3339Nano))
+	write("level", strings.ToLower(logLevelNames[level]))
+	write("msg", msg)
+	for i := 0; i < len(fields); i += 2 {
+		write(fmt.Sprint(fields[i]), fields[i+1])
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+//输出日志，level为日志级别，第一个参数可以是format
+func (l *Logger) Log(level LogLevel, a ...interface{}) {
+	if len(a) == 0 || !l.Enabled(level) {
+		return
+	}
+
+	var content string
+	if s, ok := a[0].(string); ok {
+		content = fmt.Sprintf(s, a[1:]...)
+	} else {
+		content = fmt.Sprint(a...)
+	}
+	l.Logw(level, content)
+}
+
+//输出带键值对的普通信息日志
+func (l *Logger) Info(msg string, fields ...interface{}) {
+	l.Logw(LogLevelInfo, msg, fields...)
+}
+
+//输出带键值对的调试日志
+func (l *Logger) Debug(msg string, fields ...interface{}) {
+	l.Logw(LogLevelDebug, msg, fields...)
+}
+
+//输出带键值对的错误日志
+func (l *Logger) Error(msg string, fields ...interface{}) {
+	l.Logw(LogLevelError, msg, fields...)
 }
 
 //普通信息日志输出，第一个参数可以是format
@@ -0,0 +1,419 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package bigo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultDurationBuckets are buckets of request latency histogram in seconds.
+	DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// DefaultSizeBuckets are buckets of response size histogram in bytes.
+	DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+)
+
+// metric is a family of series of the same name, series are identified by label values.
+type metric struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64
+
+	lock   sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string
+	value  float64
+	// Counts of observations in buckets, not cumulative, and sum of them for histogram.
+	counts []uint64
+	count  uint64
+}
+
+// get returns series of label values, it panics if number of values does not match labels.
+// Caller must hold the lock.
+func (m *metric) get(values []string) *series {
+	if len(values) != len(m.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", m.name, len(m.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		if m.typ == "histogram" {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+func (m *metric) add(v float64, values []string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.get(values).value += v
+}
+
+func (m *metric) set(v float64, values []string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.get(values).value = v
+}
+
+func (m *metric) observe(v float64, values []string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	s := m.get(values)
+	if i := sort.SearchFloat64s(m.buckets, v); i < len(m.buckets) {
+		s.counts[i]++
+	}
+	s.value += v
+	s.count++
+}
+
+// Counter is a metric that only goes up, like number of requests.
+type Counter struct {
+	m *metric
+}
+
+// Inc increases series of given label values by 1.
+func (c *Counter) Inc(labelValues ...string) {
+	c.m.add(1, labelValues)
+}
+
+// Add increases series of given label values by v, which must not be negative.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: counter " + c.m.name + " cannot decrease")
+	}
+	c.m.add(v, labelValues)
+}
+
+// Gauge is a metric that goes up and down, like number of connections.
+type Gauge struct {
+	m *metric
+}
+
+func (g *Gauge) Inc(labelValues ...string) {
+	g.m.add(1, labelValues)
+}
+
+func (g *Gauge) Dec(labelValues ...string) {
+	g.m.add(-1, labelValues)
+}
+
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.m.add(v, labelValues)
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.m.set(v, labelValues)
+}
+
+// Histogram is a metric that counts observations in buckets, like request latency.
+type Histogram struct {
+	m *metric
+}
+
+// Observe adds an observation to series of given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.m.observe(v, labelValues)
+}
+
+// MetricsRegistry holds metrics and writes them in Prometheus text exposition format.
+type MetricsRegistry struct {
+	lock    sync.Mutex
+	metrics map[string]*metric
+}
+
+// DefaultMetrics is the registry used by Metrics middleware and websockets by default.
+var DefaultMetrics = NewMetricsRegistry()
+
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{metrics: make(map[string]*metric)}
+}
+
+// register returns metric of given name, it is created if not exist.
+// It panics if metric of the name exists with different type or labels.
+func (r *MetricsRegistry) register(name, help, typ string, buckets []float64, labels []string) *metric {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if m, ok := r.metrics[name]; ok {
+		if m.typ != typ || strings.Join(m.labels, ",") != strings.Join(labels, ",") {
+			panic("metrics: " + name + " is already registered with different type or labels")
+		}
+		return m
+	}
+
+	if typ == "histogram" {
+		buckets = append([]float64(nil), buckets...)
+		sort.Float64s(buckets)
+	}
+	m := &metric{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	r.metrics[name] = m
+	return m
+}
+
+// Counter returns counter of given name and label names, it is registered if not exist.
+func (r *MetricsRegistry) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register(name, help, "counter", nil, labels)}
+}
+
+// Gauge returns gauge of given name and label names, it is registered if not exist.
+func (r *MetricsRegistry) Gauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(name, help, "gauge", nil, labels)}
+}
+
+// Histogram returns histogram of given name, upper bounds of buckets and label names,
+// it is registered if not exist.
+func (r *MetricsRegistry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{r.register(name, help, "histogram", buckets, labels)}
+}
+
+// formatFloat formats value in the way of Prometheus.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeLabels writes label pairs in braces, extra is an additional name and value like "le".
+func writeLabels(buf *bytes.Buffer, names, values []string, extra ...string) {
+	if len(names) == 0 && len(extra) == 0 {
+		return
+	}
+	buf.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(name + `="` + labelValueReplacer.Replace(values[i]) + `"`)
+	}
+	if len(extra) == 2 {
+		if len(names) > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(extra[0] + `="` + extra[1] + `"`)
+	}
+	buf.WriteByte('}')
+}
+
+// write writes metric in text exposition format, series are sorted by label values.
+func (m *metric) write(buf *bytes.Buffer) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	fmt.Fprintf(buf, "# HELP %s %s\n", m.name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(m.help))
+	fmt.Fprintf(buf, "# TYPE %s %s\n", m.name, m.typ)
+
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := m.series[key]
+		if m.typ != "histogram" {
+			buf.WriteString(m.name)
+			writeLabels(buf, m.labels, s.values)
+			buf.WriteString(" " + formatFloat(s.value) + "\n")
+			continue
+		}
+
+		var cumulative uint64
+		for i, upper := range m.buckets {
+			cumulative += s.counts[i]
+			buf.WriteString(m.name + "_bucket")
+			writeLabels(buf, m.labels, s.values, "le", formatFloat(upper))
+			buf.WriteString(" " + strconv.FormatUint(cumulative, 10) + "\n")
+		}
+		buf.WriteString(m.name + "_bucket")
+		writeLabels(buf, m.labels, s.values, "le", "+Inf")
+		buf.WriteString(" " + strconv.FormatUint(s.count, 10) + "\n")
+		buf.WriteString(m.name + "_sum")
+		writeLabels(buf, m.labels, s.values)
+		buf.WriteString(" " + formatFloat(s.value) + "\n")
+		buf.WriteString(m.name + "_count")
+		writeLabels(buf, m.labels, s.values)
+		buf.WriteString(" " + strconv.FormatUint(s.count, 10) + "\n")
+	}
+}
+
+// WriteTo writes all metrics in Prometheus text exposition format, metrics are sorted by name.
+func (r *MetricsRegistry) WriteTo(w io.Writer) (int64, error) {
+	r.lock.Lock()
+	metrics := make([]*metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		metrics = append(metrics, m)
+	}
+	r.lock.Unlock()
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].name < metrics[j].name
+	})
+
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		m.write(&buf)
+	}
+	return buf.WriteTo(w)
+}
+
+// ContentMetrics is the content type of Prometheus text exposition format.
+const ContentMetrics = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler returns a handler that serves metrics of registry, e.g. m.Get("/metrics", registry.Handler()).
+func (r *MetricsRegistry) Handler() Handler {
+	return r.serve
+}
+
+func (r *MetricsRegistry) serve(ctx *Context) {
+	ctx.Resp.Header().Set(ContentType, ContentMetrics)
+	ctx.Resp.WriteHeader(http.StatusOK)
+	r.WriteTo(ctx.Resp)
+}
+
+// MetricsOptions represents a struct for specifying configuration options for the Metrics middleware.
+type MetricsOptions struct {
+	// Registry to record metrics in. Default is DefaultMetrics.
+	Registry *MetricsRegistry
+	// Path to expose metrics. Default is "/metrics", "-" means not to expose.
+	Path string
+	// Prefix of metric names. Default is "bigo".
+	Namespace string
+	// Buckets of request latency histogram in seconds. Default is DefaultDurationBuckets.
+	DurationBuckets []float64
+	// Buckets of response size histogram in bytes. Default is DefaultSizeBuckets.
+	SizeBuckets []float64
+}
+
+func prepareMetricsOptions(options []MetricsOptions) MetricsOptions {
+	var opt MetricsOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+
+	conf := GetConfig().Metrics
+	if conf == nil {
+		conf = &MetricsOpt{}
+	}
+
+	if opt.Registry == nil {
+		opt.Registry = DefaultMetrics
+	}
+	if len(opt.Path) == 0 {
+		opt.Path = conf.Path
+	}
+	if len(opt.Path) == 0 {
+		opt.Path = "/metrics"
+	}
+	if len(opt.Namespace) == 0 {
+		opt.Namespace = conf.Namespace
+	}
+	if len(opt.Namespace) == 0 {
+		opt.Namespace = "bigo"
+	}
+	if len(opt.DurationBuckets) == 0 {
+		opt.DurationBuckets = conf.DurationBuckets
+	}
+	if len(opt.DurationBuckets) == 0 {
+		opt.DurationBuckets = DefaultDurationBuckets
+	}
+	if len(opt.SizeBuckets) == 0 {
+		opt.SizeBuckets = DefaultSizeBuckets
+	}
+	return opt
+}
+
+// statusClass returns class of status code like "2xx".
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// Metrics returns a middleware that records number, latency and response size of requests
+// by method, route pattern and status class, and number of requests in flight.
+// Requests match no route are recorded with route "unmatched". Metrics are exposed
+// at opt.Path in Prometheus text exposition format. Put it before other middlewares.
+func Metrics(opts ...MetricsOptions) Handler {
+	opt := prepareMetricsOptions(opts)
+	prefix := opt.Namespace + "_"
+	labels := []string{"method", "route", "status"}
+	requests := opt.Registry.Counter(prefix+"http_requests_total",
+		"Total number of HTTP requests.", labels...)
+	durations := opt.Registry.Histogram(prefix+"http_request_duration_seconds",
+		"Latency of HTTP requests in seconds.", opt.DurationBuckets, labels...)
+	sizes := opt.Registry.Histogram(prefix+"http_response_size_bytes",
+		"Size of HTTP responses in bytes.", opt.SizeBuckets, labels...)
+	inFlight := opt.Registry.Gauge(prefix+"http_requests_in_flight",
+		"Number of HTTP requests being served.")
+	return func(ctx *Context) {
+		if opt.Path != "-" && ctx.Req.URL.Path == opt.Path &&
+			(ctx.Req.Method == "GET" || ctx.Req.Method == "HEAD") {
+			opt.Registry.serve(ctx)
+			return
+		}
+
+		start := time.Now()
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		rw := ctx.Resp
+		ctx.Next()
+
+		route := "unmatched"
+		if r := ctx.CurrentRoute(); r != nil {
+			route = r.Pattern()
+		}
+		// Nothing written means net/http will respond 200.
+		status := rw.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		values := []string{ctx.Req.Method, route, statusClass(status)}
+		requests.Inc(values...)
+		durations.Observe(time.Since(start).Seconds(), values...)
+		sizes.Observe(float64(rw.Size()), values...)
+	}
+}
@@ -0,0 +1,508 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package bigo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// MinifyFunc minifies content of a certain type.
+type MinifyFunc func(src []byte) ([]byte, error)
+
+var (
+	minifierLock sync.RWMutex
+	minifiers    = map[string]MinifyFunc{
+		"text/html":              MinifyHTML,
+		"text/css":               MinifyCSS,
+		"text/javascript":        MinifyJS,
+		"application/javascript": MinifyJS,
+		"application/json":       MinifyJSON,
+	}
+)
+
+// RegisterMinifier registers or replaces the minifier of given media type, e.g. "image/svg+xml".
+func RegisterMinifier(mediaType string, fn MinifyFunc) {
+	minifierLock.Lock()
+	defer minifierLock.Unlock()
+
+	minifiers[strings.ToLower(mediaType)] = fn
+}
+
+// getMinifier returns minifier of given Content-Type value, or nil if there is none.
+func getMinifier(contentType string) MinifyFunc {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+
+	minifierLock.RLock()
+	defer minifierLock.RUnlock()
+
+	return minifiers[mediaType]
+}
+
+// MinifyJSON removes insignificant spaces from JSON.
+func MinifyJSON(src []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, len(src)))
+	err := json.Compact(buf, src)
+	return buf.Bytes(), err
+}
+
+// MinifyCSS removes comments and collapses spaces of CSS, comments start with "/*!" are kept.
+func MinifyCSS(src []byte) ([]byte, error) {
+	out := make([]byte, 0, len(src))
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+	}
+	isTrim := func(c byte) bool {
+		return c == '{' || c == '}' || c == ';' || c == ',' || c == '>'
+	}
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '"' || c == '\'':
+			j := i + 1
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(src) {
+				j = len(src) - 1
+			}
+			out = append(out, src[i:j+1]...)
+			i = j
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				end = len(src) - i - 2
+			} else {
+				end += 2
+			}
+			if i+2 < len(src) && src[i+2] == '!' {
+				out = append(out, src[i:i+2+end]...)
+			}
+			i += 1 + end
+		case isSpace(c):
+			for i+1 < len(src) && isSpace(src[i+1]) {
+				i++
+			}
+			if len(out) == 0 || isTrim(out[len(out)-1]) || i+1 >= len(src) || isTrim(src[i+1]) {
+				continue
+			}
+			out = append(out, ' ')
+		case c == '}' && len(out) > 0 && out[len(out)-1] == ';':
+			out[len(out)-1] = '}'
+		default:
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// MinifyJS conservatively minifies JavaScript: it removes comments, blank lines and spaces at
+// start and end of lines, comments start with "/*!" are kept. Strings, template literals and
+// regular expressions are copied as they are, line breaks are kept for automatic semicolon insertion.
+func MinifyJS(src []byte) ([]byte, error) {
+	out := make([]byte, 0, len(src))
+	// Brace depths where substitutions of template literals start.
+	var templates []int
+	depth := 0
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '"' || c == '\'':
+			end := jsStringEnd(src, i)
+			out = append(out, src[i:end]...)
+			i = end - 1
+		case c == '`' || (c == '}' && len(templates) > 0 && templates[len(templates)-1] == depth):
+			if c == '}' {
+				templates = templates[:len(templates)-1]
+			}
+			end, substitution := jsTemplateEnd(src, i+1)
+			if substitution {
+				templates = append(templates, depth)
+			}
+			out = append(out, src[i:end]...)
+			i = end - 1
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i+1 < len(src) && src[i+1] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				end = len(src) - i - 2
+			} else {
+				end += 2
+			}
+			comment := src[i : i+2+end]
+			i += 1 + end
+			switch {
+			case bytes.HasPrefix(comment, []byte("/*!")):
+				out = append(out, comment...)
+			case bytes.IndexByte(comment, '\n') >= 0:
+				out = jsNewline(out)
+			default:
+				// Keep tokens around the comment apart by a single space.
+				out = bytes.TrimRight(out, " \t\f")
+				for i+1 < len(src) && (src[i+1] == ' ' || src[i+1] == '\t' || src[i+1] == '\f') {
+					i++
+				}
+				if len(out) > 0 && out[len(out)-1] != '\n' {
+					out = append(out, ' ')
+				}
+			}
+		case c == '/' && jsRegexpAllowed(out):
+			end := jsRegexpEnd(src, i)
+			out = append(out, src[i:end]...)
+			i = end - 1
+		case c == '\n':
+			out = jsNewline(out)
+		case (c == ' ' || c == '\t' || c == '\r' || c == '\f') && (len(out) == 0 || out[len(out)-1] == '\n'):
+			// Leading spaces of line.
+		default:
+			if c == '{' {
+				depth++
+			} else if c == '}' {
+				depth--
+			}
+			out = append(out, c)
+		}
+	}
+	return bytes.TrimRight(out, " \t\r\f\n"), nil
+}
+
+// jsNewline removes spaces at end of line and starts a new line, blank lines are skipped.
+func jsNewline(out []byte) []byte {
+	out = bytes.TrimRight(out, " \t\r\f")
+	if len(out) == 0 || out[len(out)-1] == '\n' {
+		return out
+	}
+	return append(out, '\n')
+}
+
+// jsStringEnd returns position after the end of string literal starts at i,
+// escaped line breaks are part of the string.
+func jsStringEnd(src []byte, i int) int {
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			if j+2 < len(src) && src[j+1] == '\r' && src[j+2] == '\n' {
+				j++
+			}
+			j++
+		case src[i], '\n':
+			return j + 1
+		}
+	}
+	return len(src)
+}
+
+// jsTemplateEnd returns position after the end of template literal part starts at i,
+// and whether it ends with the start of a substitution.
+func jsTemplateEnd(src []byte, i int) (int, bool) {
+	for j := i; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case '`':
+			return j + 1, false
+		case '$':
+			if j+1 < len(src) && src[j+1] == '{' {
+				return j + 2, true
+			}
+		}
+	}
+	return len(src), false
+}
+
+// jsRegexpEnd returns position after the end of regular expression literal starts at i,
+// slashes in character classes do not end it.
+func jsRegexpEnd(src []byte, i int) int {
+	inClass := false
+	for j := i + 1; j < len(src); j++ {
+		switch src[j] {
+		case '\\':
+			j++
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '/':
+			if !inClass {
+				return j + 1
+			}
+		case '\n':
+			return j
+		}
+	}
+	return len(src)
+}
+
+// jsRegexpKeywords are keywords after which a slash starts a regular expression.
+var jsRegexpKeywords = []string{"return", "typeof", "instanceof", "in", "of", "new", "delete",
+	"void", "throw", "case", "do", "else", "yield", "await"}
+
+// jsRegexpAllowed returns true if a slash after out starts a regular expression instead of division.
+func jsRegexpAllowed(out []byte) bool {
+	out = bytes.TrimRight(out, " \t\r\f\n")
+	if len(out) == 0 {
+		return true
+	}
+
+	c := out[len(out)-1]
+	isIdent := func(c byte) bool {
+		return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+	}
+	switch {
+	case c == ')' || c == ']' || c == '}' || c == '"' || c == '\'' || c == '`':
+		return false
+	case isIdent(c):
+		start := len(out)
+		for start > 0 && isIdent(out[start-1]) {
+			start--
+		}
+		word := string(out[start:])
+		for _, keyword := range jsRegexpKeywords {
+			if word == keyword {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// htmlRawTags are elements whose content is kept as it is.
+var htmlRawTags = []string{"pre", "textarea", "script", "style"}
+
+// MinifyHTML removes comments and collapses spaces between tags and in text,
+// content of pre, textarea, script and style elements and conditional comments are kept.
+func MinifyHTML(src []byte) ([]byte, error) {
+	out := make([]byte, 0, len(src))
+	lower := bytes.ToLower(src)
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case bytes.HasPrefix(src[i:], []byte("<!--")):
+			end := bytes.Index(src[i+4:], []byte("-->"))
+			if end < 0 {
+				end = len(src) - i - 4
+			} else {
+				end += 3
+			}
+			if bytes.HasPrefix(src[i+4:], []byte("[if")) || bytes.HasPrefix(src[i+4:], []byte("<![endif")) {
+				out = append(out, src[i:i+4+end]...)
+			}
+			i += 3 + end
+		case c == '<':
+			// Copy tag, and content of raw text elements.
+			end := htmlTagEnd(src, i)
+			out = append(out, src[i:end]...)
+			for _, tag := range htmlRawTags {
+				if htmlIsTag(lower[i+1:end], tag) {
+					closing := bytes.Index(lower[end:], []byte("</"+tag))
+					if closing < 0 {
+						closing = len(src) - end
+					}
+					out = append(out, src[end:end+closing]...)
+					end += closing
+					break
+				}
+			}
+			i = end - 1
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			for i+1 < len(src) && strings.IndexByte(" \t\n\r\f", src[i+1]) >= 0 {
+				i++
+			}
+			if len(out) == 0 || out[len(out)-1] != ' ' {
+				out = append(out, ' ')
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+	return bytes.TrimSpace(out), nil
+}
+
+// htmlTagEnd returns position after the end of tag starts at i, quotes are respected.
+func htmlTagEnd(src []byte, i int) int {
+	var quote byte
+	for j := i + 1; j < len(src); j++ {
+		c := src[j]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return j + 1
+		}
+	}
+	return len(src)
+}
+
+// htmlIsTag returns true if given tag content is the open tag of name.
+func htmlIsTag(tag []byte, name string) bool {
+	if !bytes.HasPrefix(tag, []byte(name)) {
+		return false
+	}
+	if len(tag) == len(name) {
+		return true
+	}
+	c := tag[len(name)]
+	return c == '>' || c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '/'
+}
+
+// minifyResponseWriter buffers responses with minifiable content type and minifies them at last.
+type minifyResponseWriter struct {
+	ResponseWriter
+	skip   bool
+	status int
+	buf    *bytes.Buffer
+	minify MinifyFunc
+	// Content-Encoding set before handlers, e.g. by Gziper.
+	encoding string
+}
+
+// prepare decides whether to buffer the response by content type.
+func (w *minifyResponseWriter) prepare(p []byte) {
+	// Bodies encoded by handlers themselves can not be minified.
+	if w.buf != nil || w.skip || w.Header().Get(HeaderContentEncoding) != w.encoding {
+		return
+	}
+
+	contentType := w.Header().Get(HeaderContentType)
+	if len(contentType) == 0 {
+		if p == nil {
+			return
+		}
+		contentType = http.DetectContentType(p)
+		w.Header().Set(HeaderContentType, contentType)
+	}
+	if w.minify = getMinifier(contentType); w.minify != nil {
+		w.buf = new(bytes.Buffer)
+	}
+}
+
+func (w *minifyResponseWriter) WriteHeader(s int) {
+	w.prepare(nil)
+	if w.buf == nil {
+		w.ResponseWriter.WriteHeader(s)
+		return
+	}
+	if w.status == 0 {
+		w.status = s
+	}
+}
+
+func (w *minifyResponseWriter) Write(p []byte) (int, error) {
+	if !w.Written() {
+		w.prepare(p)
+	}
+	if w.buf == nil {
+		return w.ResponseWriter.Write(p)
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.buf.Write(p)
+}
+
+func (w *minifyResponseWriter) Status() int {
+	if w.buf != nil {
+		return w.status
+	}
+	return w.ResponseWriter.Status()
+}
+
+func (w *minifyResponseWriter) Written() bool {
+	return w.status != 0 || w.ResponseWriter.Written()
+}
+
+// Flush does nothing while buffering, buffered response must be written as a whole.
+func (w *minifyResponseWriter) Flush() {
+	if w.buf == nil {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *minifyResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the ResponseWriter doesn't support the Hijacker interface")
+	}
+	return hijacker.Hijack()
+}
+
+// finish minifies and writes buffered response, original content is written if minifier fails.
+func (w *minifyResponseWriter) finish() {
+	if w.buf == nil {
+		return
+	}
+
+	body := w.buf.Bytes()
+	if min, err := w.minify(body); err == nil {
+		body = min
+	}
+	w.Header().Del(HeaderContentLength)
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(body)
+}
+
+// NoMinify is a handler to opt a route out of minification, it must be used after Minifier.
+func NoMinify() Handler {
+	return func(ctx *Context) {
+		skipMinify(ctx)
+	}
+}
+
+// skipMinify disables minification of current response.
+func skipMinify(ctx *Context) {
+	if w, ok := ctx.Resp.(*minifyResponseWriter); ok && w.buf == nil {
+		w.skip = true
+	}
+}
+
+// Minifier returns a Handler that minifies response bodies with registered minifiers by Content-Type.
+// Put it after Gziper and before middlewares that write response, like Renderer.
+func Minifier() Handler {
+	return func(ctx *Context) {
+		mw := &minifyResponseWriter{
+			ResponseWriter: ctx.Resp,
+			encoding:       ctx.Resp.Header().Get(HeaderContentEncoding),
+		}
+		ctx.Resp = mw
+		ctx.MapTo(mw, (*http.ResponseWriter)(nil))
+
+		ctx.Next()
+
+		mw.finish()
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package bigo
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EncodeFunc encodes data of response in a certain media type.
+type EncodeFunc func(v interface{}) ([]byte, error)
+
+var (
+	encoderLock sync.RWMutex
+	encoders    = map[string]EncodeFunc{}
+)
+
+// RegisterEncoder registers or replaces the encoder of given media type for Negotiate,
+// e.g. "application/x-yaml" or "application/msgpack".
+func RegisterEncoder(mediaType string, fn EncodeFunc) {
+	encoderLock.Lock()
+	defer encoderLock.Unlock()
+
+	encoders[strings.ToLower(mediaType)] = fn
+}
+
+// getEncoder returns encoder of given media type, or nil if there is none.
+func getEncoder(mediaType string) EncodeFunc {
+	encoderLock.RLock()
+	defer encoderLock.RUnlock()
+
+	return encoders[mediaType]
+}
+
+// NegotiateOptions is the options of Negotiate.
+type NegotiateOptions struct {
+	// Template to render for HTML, HTML is offered only when it is set.
+	Template string
+	// Template set of Template, default is the default template set.
+	TemplateSet string
+	// HTMLOptions to render Template.
+	HTMLOptions []HTMLOptions
+	// Offers are media types to choose from in order of preference. Default is text/html,
+	// application/json, application/xml, text/xml, text/plain and registered encoders.
+	Offers []string
+}
+
+// offers returns media types to choose from.
+func (opt NegotiateOptions) offers() []string {
+	if len(opt.Offers) > 0 {
+		return opt.Offers
+	}
+
+	encoderLock.RLock()
+	custom := make([]string, 0, len(encoders))
+	for mediaType := range encoders {
+		custom = append(custom, mediaType)
+	}
+	encoderLock.RUnlock()
+	sort.Strings(custom)
+
+	offers := make([]string, 0, 5+len(custom))
+	if len(opt.Template) > 0 {
+		offers = append(offers, ContentHTML)
+	}
+	offers = append(offers, ContentJSON, "application/xml", ContentXML, CONTENT_PLAIN)
+	return append(offers, custom...)
+}
+
+// acceptRange is a media range of Accept header.
+type acceptRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// match returns specificity of range matching given media type, or -1 if it does not match.
+func (a acceptRange) match(mediaType string) int {
+	typ, subtype := mediaType, ""
+	if i := strings.Index(mediaType, "/"); i >= 0 {
+		typ, subtype = mediaType[:i], mediaType[i+1:]
+	}
+	switch {
+	case a.typ == "*" && a.subtype == "*":
+		return 0
+	case a.typ != typ:
+		return -1
+	case a.subtype == "*":
+		return 1
+	case a.subtype == subtype:
+		return 2
+	}
+	return -1
+}
+
+// parseAccept parses media ranges of Accept header, parameters other than q are ignored.
+func parseAccept(header string) []acceptRange {
+	ranges := make([]acceptRange, 0, 4)
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if len(mediaType) == 0 {
+			continue
+		}
+		a := acceptRange{typ: mediaType, subtype: "*", q: 1}
+		if i := strings.Index(mediaType, "/"); i >= 0 {
+			a.typ, a.subtype = mediaType[:i], mediaType[i+1:]
+		}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					a.q = q
+				}
+			}
+		}
+		ranges = append(ranges, a)
+	}
+	return ranges
+}
+
+// NegotiateContentType returns the offer most preferred by Accept header, offers are in order of
+// preference of server. It returns the first offer if header is empty, or "" if no offer is acceptable.
+func NegotiateContentType(header string, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if len(strings.TrimSpace(header)) == 0 {
+		return offers[0]
+	}
+
+	ranges := parseAccept(header)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		// Quality of offer is given by the most specific range matches it.
+		q, specificity := 0.0, -1
+		for _, a := range ranges {
+			if s := a.match(strings.ToLower(offer)); s > specificity {
+				q, specificity = a.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// Negotiate renders data in HTML, JSON, XML, plain text or a registered encoding chosen
+// by Accept header of request, it responds 406 if none of them is acceptable.
+// XML is always rendered as text/xml.
+func (r *TplRender) Negotiate(status int, data interface{}, opts ...NegotiateOptions) {
+	var opt NegotiateOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	r.Header().Add(HeaderVary, "Accept")
+	var accept string
+	if r.req != nil {
+		accept = r.req.Header.Get("Accept")
+	}
+	mediaType := NegotiateContentType(accept, opt.offers())
+
+	switch mediaType {
+	case "":
+		http.Error(r, "406 not acceptable", http.StatusNotAcceptable)
+	case ContentHTML:
+		setName := opt.TemplateSet
+		if len(setName) == 0 {
+			setName = _DEFAULT_TPL_SET_NAME
+		}
+		r.renderHTML(status, setName, opt.Template, data, opt.HTMLOptions...)
+	case ContentJSON:
+		r.JSON(status, data)
+	case ContentXML, "application/xml":
+		r.XML(status, data)
+	case CONTENT_PLAIN:
+		r.Header().Set(ContentType, CONTENT_PLAIN+r.CompiledCharset)
+		r.WriteHeader(status)
+		fmt.Fprint(r, data)
+	default:
+		encode := getEncoder(strings.ToLower(mediaType))
+		if encode == nil {
+			http.Error(r, "406 not acceptable", http.StatusNotAcceptable)
+			return
+		}
+		result, err := encode(data)
+		if err != nil {
+			http.Error(r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		r.Header().Set(ContentType, mediaType)
+		r.WriteHeader(status)
+		r.Write(result)
+	}
+}
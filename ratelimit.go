@@ -0,0 +1,281 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package bigo
+
+import (
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitAlgorithm represents the algorithm to limit requests.
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucket refills Limit tokens evenly in every Period, bursts up to Limit are allowed.
+	TokenBucket RateLimitAlgorithm = iota
+	// SlidingWindow allows at most Limit requests in any time span of Period.
+	SlidingWindow
+)
+
+// RateLimit represents a limit of requests in a period.
+type RateLimit struct {
+	Limit     int
+	Period    time.Duration
+	Algorithm RateLimitAlgorithm
+}
+
+// RateLimitResult represents the result of taking a request from store.
+type RateLimitResult struct {
+	// Whether the request is allowed.
+	Allowed bool
+	// Number of requests that can still be made right now.
+	Remaining int
+	// Time until the limit is fully available again.
+	Reset time.Duration
+	// Time until next request will be allowed, 0 if it is allowed now.
+	RetryAfter time.Duration
+}
+
+// RateLimitStore is the interface that keeps rate limit state by key,
+// implement it to share limits between instances with external storage.
+type RateLimitStore interface {
+	// Take takes one request for given key under given limit.
+	Take(key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// rateLimitEntry is the state of a key in memory store.
+type rateLimitEntry struct {
+	// Token bucket state.
+	tokens float64
+	last   time.Time
+	// Sliding window state, times of requests in current window.
+	hits []time.Time
+	// Time after which the state is the same as a new key,
+	// so that keys under different periods are cleaned up by their own.
+	expires time.Time
+}
+
+type rateLimitShard struct {
+	lock    sync.Mutex
+	entries map[string]*rateLimitEntry
+	takes   int
+}
+
+// MemoryRateLimitStore is a RateLimitStore keeps state in memory,
+// keys are spread over shards so that each shard is locked separately.
+type MemoryRateLimitStore struct {
+	shards []*rateLimitShard
+}
+
+// NewMemoryRateLimitStore creates and returns a new memory store with given number of shards, default is 32.
+func NewMemoryRateLimitStore(shards ...int) *MemoryRateLimitStore {
+	n := 32
+	if len(shards) > 0 && shards[0] > 0 {
+		n = shards[0]
+	}
+	s := &MemoryRateLimitStore{make([]*rateLimitShard, n)}
+	for i := range s.shards {
+		s.shards[i] = &rateLimitShard{entries: make(map[string]*rateLimitEntry)}
+	}
+	return s
+}
+
+func (s *MemoryRateLimitStore) shard(key string) *rateLimitShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// Take takes one request for given key under given limit.
+func (s *MemoryRateLimitStore) Take(key string, limit RateLimit) (RateLimitResult, error) {
+	now := time.Now()
+	shard := s.shard(key)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	// Clean up idle keys from time to time.
+	shard.takes++
+	if shard.takes%1024 == 0 {
+		for k, e := range shard.entries {
+			if now.After(e.expires) {
+				delete(shard.entries, k)
+			}
+		}
+	}
+
+	e, ok := shard.entries[key]
+	if !ok {
+		e = &rateLimitEntry{tokens: float64(limit.Limit), last: now}
+		shard.entries[key] = e
+	}
+
+	e.expires = now.Add(limit.Period)
+	if limit.Algorithm == SlidingWindow {
+		return e.takeWindow(limit, now), nil
+	}
+	return e.takeToken(limit, now), nil
+}
+
+func (e *rateLimitEntry) takeToken(limit RateLimit, now time.Time) RateLimitResult {
+	rate := float64(limit.Limit) / limit.Period.Seconds()
+	e.tokens = math.Min(float64(limit.Limit), e.tokens+now.Sub(e.last).Seconds()*rate)
+	e.last = now
+
+	var r RateLimitResult
+	if e.tokens >= 1 {
+		e.tokens--
+		r.Allowed = true
+	} else {
+		r.RetryAfter = time.Duration((1 - e.tokens) / rate * float64(time.Second))
+	}
+	r.Remaining = int(e.tokens)
+	r.Reset = time.Duration((float64(limit.Limit) - e.tokens) / rate * float64(time.Second))
+	return r
+}
+
+func (e *rateLimitEntry) takeWindow(limit RateLimit, now time.Time) RateLimitResult {
+	e.last = now
+	start := now.Add(-limit.Period)
+	i := 0
+	for i < len(e.hits) && !e.hits[i].After(start) {
+		i++
+	}
+	e.hits = e.hits[i:]
+
+	var r RateLimitResult
+	if len(e.hits) < limit.Limit {
+		e.hits = append(e.hits, now)
+		r.Allowed = true
+	} else {
+		r.RetryAfter = e.hits[0].Sub(start)
+	}
+	r.Remaining = limit.Limit - len(e.hits)
+	if len(e.hits) > 0 {
+		r.Reset = e.hits[len(e.hits)-1].Sub(start)
+	}
+	return r
+}
+
+// RateLimitKeyFunc returns the key to limit requests by, empty key means not to limit the request.
+type RateLimitKeyFunc func(ctx *Context) string
+
+// KeyByRemoteAddr limits requests by address of client.
+func KeyByRemoteAddr() RateLimitKeyFunc {
+	return func(ctx *Context) string {
+		return ctx.RemoteAddr()
+	}
+}
+
+// KeyByHeader limits requests by value of given header, e.g. "X-API-Key".
+func KeyByHeader(name string) RateLimitKeyFunc {
+	return func(ctx *Context) string {
+		return ctx.Req.Header.Get(name)
+	}
+}
+
+// KeyByParam limits requests by value of given route param, e.g. ":user".
+func KeyByParam(name string) RateLimitKeyFunc {
+	return func(ctx *Context) string {
+		return ctx.Params(name)
+	}
+}
+
+// RateLimitOptions represents a struct for specifying configuration options for the RateLimiter middleware.
+type RateLimitOptions struct {
+	// Max number of requests in a period. Default is 60.
+	Limit int
+	// Length of period. Default is 1 minute.
+	Period time.Duration
+	// Algorithm to limit requests. Default is TokenBucket.
+	Algorithm RateLimitAlgorithm
+	// Function to extract key from request. Default is KeyByRemoteAddr.
+	KeyFunc RateLimitKeyFunc
+	// Store to keep state. Default is a new memory store for each middleware.
+	Store RateLimitStore
+	// Prefix of keys, set different prefixes when a store is shared by multiple middlewares.
+	Prefix string
+	// Whether not to send X-RateLimit-* headers. Default is false.
+	SkipHeaders bool
+	// Handler for limited requests. Default is responding 429 with error message.
+	ErrorFunc func(ctx *Context, r RateLimitResult)
+}
+
+func prepareRateLimitOptions(options []RateLimitOptions) RateLimitOptions {
+	var opt RateLimitOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+
+	if opt.Limit <= 0 {
+		opt.Limit = 60
+	}
+	if opt.Period <= 0 {
+		opt.Period = time.Minute
+	}
+	if opt.KeyFunc == nil {
+		opt.KeyFunc = KeyByRemoteAddr()
+	}
+	if opt.Store == nil {
+		opt.Store = NewMemoryRateLimitStore()
+	}
+	if opt.ErrorFunc == nil {
+		opt.ErrorFunc = func(ctx *Context, r RateLimitResult) {
+			http.Error(ctx.Resp, "429 too many requests", http.StatusTooManyRequests)
+		}
+	}
+
+	return opt
+}
+
+// ceilSeconds returns d in whole seconds rounded up.
+func ceilSeconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// RateLimiter is a middleware that limits the rate of requests by key. It can be used
+// globally, or passed to Router.Group and route handlers for per-group and per-route limits.
+// Requests are allowed when the store fails, and the error is logged.
+func RateLimiter(options ...RateLimitOptions) Handler {
+	opt := prepareRateLimitOptions(options)
+	limit := RateLimit{opt.Limit, opt.Period, opt.Algorithm}
+
+	return func(ctx *Context, log *Logger) {
+		key := opt.KeyFunc(ctx)
+		if len(key) == 0 {
+			return
+		}
+
+		r, err := opt.Store.Take(opt.Prefix+key, limit)
+		if err != nil {
+			log.LogError("rate limit: %v", err)
+			return
+		}
+
+		if !opt.SkipHeaders {
+			header := ctx.Resp.Header()
+			header.Set("X-RateLimit-Limit", strconv.Itoa(opt.Limit))
+			header.Set("X-RateLimit-Remaining", strconv.Itoa(r.Remaining))
+			header.Set("X-RateLimit-Reset", ceilSeconds(r.Reset))
+		}
+		if !r.Allowed {
+			ctx.Resp.Header().Set("Retry-After", ceilSeconds(r.RetryAfter))
+			opt.ErrorFunc(ctx, r)
+		}
+	}
+}
@@ -18,6 +18,7 @@ package bigo
 import (
 	"bytes"
 	"fmt"
+	"html/template"
 	"io/ioutil"
 	"net/http"
 	"runtime"
@@ -56,6 +57,7 @@ pre {
 </style>
 </head><body>
 <h1>PANIC</h1>
+<pre>Request ID: %s</pre>
 <pre style="font-weight: bold;">%s</pre>
 <pre>%s</pre>
 </body>
@@ -139,6 +141,11 @@ func Recovery() Handler {
 				stack := stack(3)
 				log.LogError("PANIC: %s\n%s", err, stack)
 
+				// Registered error handlers take place of the default response.
+				if c.runErrorHandler(http.StatusInternalServerError, fmt.Errorf("panic: %v", err)) {
+					return
+				}
+
 				// Lookup the current responsewriter
 				val := c.GetVal(inject.InterfaceOf((*http.ResponseWriter)(nil)))
 				res := val.Interface().(http.ResponseWriter)
@@ -147,7 +154,7 @@ func Recovery() Handler {
 				var body []byte
 				if Env == Dev {
 					res.Header().Set("Content-Type", "text/html")
-					body = []byte(fmt.Sprintf(panicHtml, err, err, stack))
+					body = []byte(fmt.Sprintf(panicHtml, err, template.HTMLEscapeString(c.RequestID()), err, stack))
 				}
 
 				res.WriteHeader(http.StatusInternalServerError)
@@ -17,18 +17,23 @@ package bigo
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"hash/fnv"
 	"html/template"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fym201/bigo/utl"
@@ -61,6 +66,16 @@ var (
 			return "", nil
 		},
 		"unescaped": func (x string) interface{} { return template.HTML(x) },
+		"urlfor": func(string, ...interface{}) (string, error) {
+			return "", fmt.Errorf("urlfor called with no router")
+		},
+		"csrf_field": func() (template.HTML, error) {
+			return "", fmt.Errorf("csrf_field called with no CSRF middleware")
+		},
+		"partial": func(string, ...interface{}) (template.HTML, error) {
+			return "", fmt.Errorf("partial called with no template set")
+		},
+		"asset": Asset,
 	}
 )
 
@@ -89,7 +104,10 @@ type (
 		// Directory to load templates. Default is "templates".
 		Directory string
 		// Layout template name. Will not render a layout if "". Default is to "".
+		// It can be overridden by "Layout" in context data, e.g. ctx.Data["Layout"] = "admin/layout".
 		Layout string
+		// SetLayouts are default layouts of template sets by set name, which override Layout.
+		SetLayouts map[string]string
 		// Extensions to parse template files from. Defaults are [".tmpl", ".html"].
 		Extensions []string
 		// Funcs is a slice of FuncMaps to apply to the template upon compilation. This is useful for helper functions. Default is [].
@@ -110,6 +128,15 @@ type (
 		HTMLContentType string
 		// TemplateFileSystem is the interface for supporting any implmentation of template file system.
 		TemplateFileSystem
+		// Engine to parse templates. Default is HTMLEngine.
+		Engine TemplateEngine
+		// ExtensionEngines are engines of templates by extension, e.g. ".txt": TextEngine, which override Engine.
+		ExtensionEngines map[string]TemplateEngine
+		// SetEngines are engines of template sets by set name, which override Engine.
+		SetEngines map[string]TemplateEngine
+		// FileSystem to load templates from instead of disk, e.g. embed.FS or OpenZipFS,
+		// Directory is the path in it. It is ignored when TemplateFileSystem is set.
+		FileSystem fs.FS
 	}
 
 	// HTMLOptions is a struct for overriding some rendering Options for specific HTML call
@@ -133,6 +160,7 @@ type (
 		HTMLSetBytes(string, string, interface{}, ...HTMLOptions) ([]byte, error)
 		HTMLBytes(string, interface{}, ...HTMLOptions) ([]byte, error)
 		XML(int, interface{})
+		Negotiate(int, interface{}, ...NegotiateOptions)
 		Error(int, ...string)
 		Status(int)
 		SetTemplatePath(string, string)
@@ -226,70 +254,259 @@ func GetExt(s string) string {
 	return s[index:]
 }
 
-func compile(opt RenderOptions) *template.Template {
-	dir := opt.Directory
-	t := template.New(dir)
-	t.Delims(opt.Delims.Left, opt.Delims.Right)
-	// Parse an initial template in case we don't have any.
-	template.Must(t.Parse("Macaron"))
+// compile compiles templates of a set, files are parsed by engines of their extensions,
+// and the rest by engine of the set. The first of returned templates is by engine of the set.
+func compile(opt RenderOptions) (ts []Templates, err error) {
+	// Template file systems panic when they fail to read files.
+	defer func() {
+		if e := recover(); e != nil {
+			ts, err = nil, fmt.Errorf("%v", e)
+		}
+	}()
 
 	if opt.TemplateFileSystem == nil {
-		opt.TemplateFileSystem = NewTemplateFileSystem(opt, false)
+		if opt.FileSystem != nil {
+			opt.TemplateFileSystem = NewTemplateFileSystemFS(opt.FileSystem, opt, false)
+		} else {
+			opt.TemplateFileSystem = NewTemplateFileSystem(opt, false)
+		}
+	}
+	if opt.Engine == nil {
+		opt.Engine = HTMLEngine
 	}
 
+	// Files grouped by extensions that have own engines, "" is for the rest.
+	groups := map[string][]TemplateFile{"": nil}
 	for _, f := range opt.TemplateFileSystem.ListFiles() {
-		tmpl := t.New(f.Name())
-		for _, funcs := range opt.Funcs {
-			tmpl.Funcs(funcs)
+		ext := ""
+		if _, ok := opt.ExtensionEngines[f.Ext()]; ok {
+			ext = f.Ext()
 		}
-		// Bomb out if parse fails. We don't want any silent server starts.
-		template.Must(tmpl.Funcs(helperFuncs).Parse(string(f.Data())))
+		groups[ext] = append(groups[ext], f)
+	}
+	exts := make([]string, 0, len(groups))
+	for ext := range groups {
+		exts = append(exts, ext)
 	}
+	sort.Strings(exts)
 
-	return t
+	funcs := make([]template.FuncMap, 0, len(opt.Funcs)+1)
+	funcs = append(funcs, opt.Funcs...)
+	funcs = append(funcs, helperFuncs)
+	for _, ext := range exts {
+		engine := opt.Engine
+		if len(ext) > 0 {
+			engine = opt.ExtensionEngines[ext]
+		}
+		t, err := engine.Parse(groups[ext], opt.Delims, funcs)
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+// templateSignature returns signature of template files by their names, sizes and modification times,
+// which changes when any file is added, removed or modified. It is empty if files can not be walked.
+func templateSignature(opt RenderOptions) string {
+	if opt.TemplateFileSystem != nil {
+		return ""
+	}
+
+	h := fnv.New64a()
+	add := func(name string, fi os.FileInfo) {
+		ext := GetExt(name)
+		for _, extension := range opt.Extensions {
+			if ext == extension {
+				fmt.Fprintf(h, "%s|%d|%d\n", name, fi.Size(), fi.ModTime().UnixNano())
+				return
+			}
+		}
+	}
+
+	var err error
+	if opt.FileSystem != nil {
+		var sub fs.FS
+		if sub, err = subFS(opt.FileSystem, opt.Directory); err == nil {
+			err = fs.WalkDir(sub, ".", func(p string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				fi, err := d.Info()
+				if err == nil {
+					add(p, fi)
+				}
+				return err
+			})
+		}
+	} else {
+		err = filepath.Walk(opt.Directory, func(p string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() {
+				return err
+			}
+			add(p, fi)
+			return nil
+		})
+	}
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", h.Sum64())
 }
 
 const (
 	_DEFAULT_TPL_SET_NAME = "DEFAULT"
 )
 
-// templateSet represents a template set of type *template.Template.
+// templateSetEntry is a compiled template set.
+type templateSetEntry struct {
+	// Templates by engines, the first is by engine of the set.
+	ts  []Templates
+	opt RenderOptions
+	// Error of compiling, which is reported when rendering in development mode.
+	err error
+	// Signature of template files when compiled.
+	sig string
+}
+
+func newTemplateSetEntry(opt RenderOptions) *templateSetEntry {
+	e := &templateSetEntry{opt: opt, sig: templateSignature(opt)}
+	e.ts, e.err = compile(opt)
+	return e
+}
+
+// lookup returns templates that template of name should be executed in.
+func (e *templateSetEntry) lookup(name string) Templates {
+	for _, t := range e.ts {
+		if t.Lookup(name) {
+			return t
+		}
+	}
+	return e.ts[0]
+}
+
+func (e *templateSetEntry) Lookup(name string) bool {
+	for _, t := range e.ts {
+		if t.Lookup(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *templateSetEntry) Execute(w io.Writer, name string, data interface{}, funcs template.FuncMap) error {
+	return e.lookup(name).Execute(w, name, data, funcs)
+}
+
+// templateSet represents template sets by name.
+// Sets are kept in a map that is replaced as a whole on change, so that reading needs no lock.
 type templateSet struct {
-	lock sync.RWMutex
-	sets map[string]*template.Template
-	dirs map[string]string
+	lock sync.Mutex
+	sets atomic.Value // map[string]*templateSetEntry
 }
 
 func newTemplateSet() *templateSet {
-	return &templateSet{
-		sets: make(map[string]*template.Template),
-		dirs: make(map[string]string),
+	ts := &templateSet{}
+	ts.sets.Store(make(map[string]*templateSetEntry))
+	return ts
+}
+
+func (ts *templateSet) entries() map[string]*templateSetEntry {
+	return ts.sets.Load().(map[string]*templateSetEntry)
+}
+
+// store stores entry of set, caller must hold the lock.
+func (ts *templateSet) store(name string, e *templateSetEntry) {
+	old := ts.entries()
+	sets := make(map[string]*templateSetEntry, len(old)+1)
+	for k, v := range old {
+		sets[k] = v
 	}
+	sets[name] = e
+	ts.sets.Store(sets)
 }
 
-func (ts *templateSet) Set(name string, opt *RenderOptions) *template.Template {
-	t := compile(*opt)
+// Set compiles and stores template set. It panics if fail to compile
+// unless in development mode, where the error is reported when rendering.
+func (ts *templateSet) Set(name string, opt *RenderOptions) Templates {
+	o := *opt
+	if engine, ok := o.SetEngines[name]; ok {
+		o.Engine = engine
+	}
+	e := newTemplateSetEntry(o)
+	if e.err != nil && Env != Dev {
+		panic("template: " + e.err.Error())
+	}
 
 	ts.lock.Lock()
 	defer ts.lock.Unlock()
 
-	ts.sets[name] = t
-	ts.dirs[name] = opt.Directory
-	return t
+	ts.store(name, e)
+	return e
 }
 
-func (ts *templateSet) Get(name string) *template.Template {
-	//ts.lock.RLock()
-	//defer ts.lock.RUnlock()
-
-	return ts.sets[name]
+func (ts *templateSet) Get(name string) Templates {
+	if e := ts.entries()[name]; e != nil && e.err == nil {
+		return e
+	}
+	return nil
 }
 
 func (ts *templateSet) GetDir(name string) string {
-	//ts.lock.RLock()
-	//defer ts.lock.RUnlock()
+	if e := ts.entries()[name]; e != nil {
+		return e.opt.Directory
+	}
+	return ""
+}
+
+// reload recompiles template set if any of its files is changed, and returns
+// the template set with error of compiling. It is used in development mode.
+func (ts *templateSet) reload(name string) (*templateSetEntry, error) {
+	e := ts.entries()[name]
+	if e == nil {
+		return nil, nil
+	}
+
+	if sig := templateSignature(e.opt); sig != e.sig || len(sig) == 0 {
+		ts.lock.Lock()
+		// Other request may have reloaded it.
+		if cur := ts.entries()[name]; cur == e {
+			e = newTemplateSetEntry(e.opt)
+			ts.store(name, e)
+		} else {
+			e = cur
+		}
+		ts.lock.Unlock()
+	}
+	if e.err != nil {
+		return nil, &templateError{name, e.err}
+	}
+	return e, nil
+}
+
+// check returns error of the first template set fails to compile, sets are reloaded in development mode.
+func (ts *templateSet) check() error {
+	for name, e := range ts.entries() {
+		if Env == Dev {
+			if _, err := ts.reload(name); err != nil {
+				return fmt.Errorf("template set %q: %v", name, err)
+			}
+		} else if e.err != nil {
+			return fmt.Errorf("template set %q: %v", name, e.err)
+		}
+	}
+	return nil
+}
+
+// templateError is the error of compiling template set.
+type templateError struct {
+	set string
+	err error
+}
 
-	return ts.dirs[name]
+func (e *templateError) Error() string {
+	return e.err.Error()
 }
 
 func prepareOptions(options []RenderOptions) RenderOptions {
@@ -344,6 +561,10 @@ func renderHandler(opt RenderOptions, tplSets []string) Handler {
 		tmpOpt.Directory = tplDir
 		ts.Set(tplName, &tmpOpt)
 	}
+	// Each directory has its own check, so that renderers do not replace checks of each other.
+	DefaultHealth.Register("templates:"+opt.Directory, 0, func(context.Context) error {
+		return ts.check()
+	})
 
 	return func(ctx *Context) {
 		r := &TplRender{
@@ -351,6 +572,10 @@ func renderHandler(opt RenderOptions, tplSets []string) Handler {
 			templateSet:     ts,
 			Opt:             &opt,
 			CompiledCharset: cs,
+			ctx:             ctx,
+			router:          ctx.Router,
+			req:             ctx.Req.Request,
+			ctxData:         ctx.Data,
 		}
 		ctx.Data["TmplLoadTimes"] = func() string {
 			if r.startTime.IsZero() {
@@ -367,10 +592,11 @@ func renderHandler(opt RenderOptions, tplSets []string) Handler {
 // Renderer is a Middleware that maps a macaron.Render service into the Macaron handler chain.
 // An single variadic macaron.RenderOptions struct can be optionally provided to configure
 // HTML rendering. The default directory for templates is "templates" and the default
-// file extension is ".tmpl" and ".html".
+// file extension is ".tmpl" and ".html". Template sets are checked by health check "templates:" followed by Directory.
 //
-// If MACARON_ENV is set to "" or "development" then templates will be recompiled on every request. For more performance, set the
-// MACARON_ENV environment variable to "production".
+// In development mode, templates are recompiled when any file of the template set is added, removed
+// or modified, and errors of templates are shown as error page instead of panic. Set RunMode to "PROD"
+// for more performance, where templates are compiled once at startup.
 func Renderer(options ...RenderOptions) Handler {
 	return renderHandler(prepareOptions(options), []string{})
 }
@@ -385,6 +611,10 @@ type TplRender struct {
 	Opt             *RenderOptions
 	CompiledCharset string
 
+	ctx       *Context
+	router    *Router
+	req       *http.Request
+	ctxData   map[string]interface{}
 	startTime time.Time
 }
 
@@ -466,49 +696,100 @@ func (r *TplRender) RenderData(status int, v []byte) {
 	r.data(status, CONTENT_PLAIN, v)
 }
 
-func (r *TplRender) execute(t *template.Template, name string, data interface{}) (*bytes.Buffer, error) {
+func (r *TplRender) execute(t Templates, name string, data interface{}, funcs template.FuncMap) (*bytes.Buffer, error) {
 	buf := bufpool.Get()
-	return buf, t.ExecuteTemplate(buf, name, data)
+	return buf, t.Execute(buf, name, data, funcs)
 }
 
-func (r *TplRender) addYield(t *template.Template, tplName string, data interface{}) {
-	funcs := template.FuncMap{
-		"yield": func() (template.HTML, error) {
-			buf, err := r.execute(t, tplName, data)
-			// return safe html here since we are rendering our own template
-			return template.HTML(buf.String()), err
-		},
-		"current": func() (string, error) {
-			return tplName, nil
-		},
+// templateFuncs returns functions depend on current request for executing templates of set.
+func (r *TplRender) templateFuncs(set Templates) template.FuncMap {
+	funcs := template.FuncMap{}
+	funcs["partial"] = func(name string, args ...interface{}) (template.HTML, error) {
+		data, err := partialData(name, args)
+		if err != nil {
+			return "", err
+		}
+		buf, err := r.execute(set, name, data, funcs)
+		return template.HTML(buf.String()), err
+	}
+	// Functions depend on request are always bound, so that none is left from other requests.
+	funcs["urlfor"] = helperFuncs["urlfor"]
+	funcs["csrf_field"] = helperFuncs["csrf_field"]
+	if r.router != nil {
+		funcs["urlfor"] = func(name string, pairs ...interface{}) (url string, err error) {
+			defer func() {
+				if e := recover(); e != nil {
+					err = fmt.Errorf("%v", e)
+				}
+			}()
+			return r.router.URLFor(name, pairs...), nil
+		}
+	}
+	if field, ok := r.ctxData["CsrfField"].(template.HTML); ok {
+		funcs["csrf_field"] = func() (template.HTML, error) {
+			return field, nil
+		}
 	}
-	t.Funcs(funcs)
+	return funcs
+}
+
+// partialData returns data of partial template from arguments of function "partial":
+// {{partial "name"}}, {{partial "name" .Item}} or {{partial "name" "key" value ...}}.
+func partialData(name string, args []interface{}) (interface{}, error) {
+	switch len(args) {
+	case 0:
+		return nil, nil
+	case 1:
+		return args[0], nil
+	}
+	if len(args)%2 != 0 {
+		return nil, fmt.Errorf("partial %q: arguments must be key and value pairs", name)
+	}
+	m := make(map[string]interface{}, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("partial %q: key must be string", name)
+		}
+		m[key] = args[i+1]
+	}
+	return m, nil
 }
 
 func (r *TplRender) renderBytes(setName, tplName string, data interface{}, htmlOpt ...HTMLOptions) (*bytes.Buffer, error) {
-	t := r.templateSet.Get(setName)
+	var e *templateSetEntry
 	if Env == Dev {
-		opt := *r.Opt
-		opt.Directory = r.templateSet.GetDir(setName)
-		t = r.templateSet.Set(setName, &opt)
+		var err error
+		if e, err = r.templateSet.reload(setName); err != nil {
+			return nil, err
+		}
+	} else {
+		e = r.templateSet.entries()[setName]
 	}
-	if t == nil {
+	if e == nil || e.err != nil {
 		return nil, fmt.Errorf("html/template: template \"%s\" is undefined", tplName)
 	}
 
-	opt := r.prepareHTMLOptions(htmlOpt)
-
-	if len(opt.Layout) > 0 {
-		r.addYield(t, tplName, data)
-		tplName = opt.Layout
+	opt := r.prepareHTMLOptions(setName, htmlOpt)
+	funcs := r.templateFuncs(e)
+	if len(opt.Layout) == 0 {
+		return r.execute(e, tplName, data, funcs)
 	}
 
-	out, err := r.execute(t, tplName, data)
-	if err != nil {
-		return nil, err
+	layoutFuncs := template.FuncMap{
+		"yield": func() (template.HTML, error) {
+			buf, err := r.execute(e, tplName, data, funcs)
+			// return safe html here since we are rendering our own template
+			return template.HTML(buf.String()), err
+		},
+		"current": func() (string, error) {
+			return tplName, nil
+		},
 	}
-
-	return out, nil
+	for k, v := range funcs {
+		layoutFuncs[k] = v
+	}
+	return r.execute(e, opt.Layout, data, layoutFuncs)
 }
 
 func (r *TplRender) renderHTML(status int, setName, tplName string, data interface{}, htmlOpt ...HTMLOptions) {
@@ -516,6 +797,10 @@ func (r *TplRender) renderHTML(status int, setName, tplName string, data interfa
 
 	out, err := r.renderBytes(setName, tplName, data, htmlOpt...)
 	if err != nil {
+		if te, ok := err.(*templateError); ok && Env == Dev {
+			r.devError(te.set, tplName, te.err)
+			return
+		}
 		http.Error(r, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -527,6 +812,22 @@ func (r *TplRender) renderHTML(status int, setName, tplName string, data interfa
 	bufpool.Put(out)
 }
 
+// devError renders error page of compiling template set in development mode.
+func (r *TplRender) devError(setName, tplName string, err error) {
+	r.Header().Set(ContentType, ContentHTML+r.CompiledCharset)
+	r.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(r, `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Template Error</title></head>
+<body>
+<h1>Template Error</h1>
+<p>Template set: %s, template: %s</p>
+<pre>%s</pre>
+</body>
+</html>
+`, template.HTMLEscapeString(setName), template.HTMLEscapeString(tplName), template.HTMLEscapeString(err.Error()))
+}
+
 func (r *TplRender) HTML(status int, name string, data interface{}, htmlOpt ...HTMLOptions) {
 	r.renderHTML(status, _DEFAULT_TPL_SET_NAME, name, data, htmlOpt...)
 }
@@ -557,8 +858,18 @@ func (r *TplRender) HTMLString(name string, data interface{}, htmlOpt ...HTMLOpt
 	return string(p), err
 }
 
-// Error writes the given HTTP status to the current ResponseWriter
+// Error writes the given HTTP status to the current ResponseWriter, it is responded by
+// registered error handlers if there are, where message is shown as the error message.
 func (r *TplRender) Error(status int, message ...string) {
+	if r.ctx != nil {
+		var err error
+		if len(message) > 0 {
+			err = NewHTTPError(status, message[0])
+		}
+		if r.ctx.runErrorHandler(status, err) {
+			return
+		}
+	}
 	r.WriteHeader(status)
 	if len(message) > 0 {
 		r.Write([]byte(message[0]))
@@ -569,10 +880,18 @@ func (r *TplRender) Status(status int) {
 	r.WriteHeader(status)
 }
 
-func (r *TplRender) prepareHTMLOptions(htmlOpt []HTMLOptions) HTMLOptions {
+// prepareHTMLOptions returns options of rendering, layout is chosen from HTMLOptions,
+// "Layout" in context data, layout of template set and default layout in order.
+func (r *TplRender) prepareHTMLOptions(setName string, htmlOpt []HTMLOptions) HTMLOptions {
 	if len(htmlOpt) > 0 {
 		return htmlOpt[0]
 	}
+	if layout, ok := r.ctxData["Layout"].(string); ok {
+		return HTMLOptions{Layout: layout}
+	}
+	if layout, ok := r.Opt.SetLayouts[setName]; ok {
+		return HTMLOptions{Layout: layout}
+	}
 
 	return HTMLOptions{
 		Layout: r.Opt.Layout,
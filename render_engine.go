@@ -0,0 +1,242 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package bigo
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"regexp"
+	"sync"
+	texttemplate "text/template"
+)
+
+// TemplateEngine is the interface of template engine, which parses template files of a set.
+type TemplateEngine interface {
+	// Parse parses files with given delimiters, funcs are applied in order and available to all templates.
+	Parse(files []TemplateFile, delims Delims, funcs []template.FuncMap) (Templates, error)
+}
+
+// Templates is the interface of parsed templates that can be executed by name.
+type Templates interface {
+	// Lookup returns true if there is template of given name.
+	Lookup(name string) bool
+	// Execute executes template of given name, funcs override functions of templates for this execution
+	// only. It is safe to be called concurrently, parsed templates are never changed by funcs.
+	Execute(w io.Writer, name string, data interface{}, funcs template.FuncMap) error
+}
+
+var (
+	// HTMLEngine is the default template engine based on html/template, which supports
+	// inheritance by {{extends "name"}} at beginning of templates.
+	HTMLEngine TemplateEngine = htmlEngine{}
+	// TextEngine is the template engine based on text/template, e.g. for plain text emails.
+	TextEngine TemplateEngine = textEngine{}
+)
+
+// defaultDelims returns delims with default values.
+func defaultDelims(delims Delims) Delims {
+	if len(delims.Left) == 0 {
+		delims.Left = "{{"
+	}
+	if len(delims.Right) == 0 {
+		delims.Right = "}}"
+	}
+	return delims
+}
+
+// mergeFuncs merges funcs in order, later ones override earlier ones.
+func mergeFuncs(funcs []template.FuncMap) template.FuncMap {
+	merged := template.FuncMap{}
+	for _, fm := range funcs {
+		for k, v := range fm {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// resetFuncs returns functions of base overridden by funcs, which restore a clone
+// of templates after execution so that it does not keep functions of a request.
+func resetFuncs(base, funcs template.FuncMap) template.FuncMap {
+	reset := make(template.FuncMap, len(funcs))
+	for k := range funcs {
+		if f, ok := base[k]; ok {
+			reset[k] = f
+		}
+	}
+	return reset
+}
+
+// extendsPattern returns pattern of extends directive at beginning of template, e.g. {{extends "layouts/base"}}.
+func extendsPattern(delims Delims) *regexp.Regexp {
+	delims = defaultDelims(delims)
+	return regexp.MustCompile(`^\s*` + regexp.QuoteMeta(delims.Left) + `-?\s*extends\s+"([^"]+)"\s*-?` + regexp.QuoteMeta(delims.Right))
+}
+
+type htmlEngine struct{}
+
+// htmlTemplates are templates parsed by htmlEngine. Templates extending others are parsed
+// into their own trees, so that blocks defined by them do not conflict.
+// Parsed trees are never executed, executions take clones from pools of trees.
+type htmlTemplates struct {
+	t        *template.Template
+	extended map[string]*template.Template
+	funcs    template.FuncMap
+	pools    map[*template.Template]*sync.Pool
+}
+
+func (htmlEngine) Parse(files []TemplateFile, delims Delims, funcs []template.FuncMap) (Templates, error) {
+	t := template.New("")
+	t.Delims(delims.Left, delims.Right)
+	// Parse an initial template in case we don't have any.
+	template.Must(t.Parse("Macaron"))
+
+	pattern := extendsPattern(delims)
+	parents := make(map[string]string)
+	contents := make(map[string]string)
+	for _, f := range files {
+		content := string(f.Data())
+		if m := pattern.FindStringSubmatchIndex(content); m != nil {
+			parents[f.Name()] = content[m[2]:m[3]]
+			content = content[m[1]:]
+		}
+		contents[f.Name()] = content
+
+		if _, ok := parents[f.Name()]; ok {
+			continue
+		}
+		tmpl := t.New(f.Name())
+		for _, fm := range funcs {
+			tmpl.Funcs(fm)
+		}
+		if _, err := tmpl.Parse(content); err != nil {
+			return nil, err
+		}
+	}
+
+	extended := make(map[string]*template.Template, len(parents))
+	for name := range parents {
+		// Ancestors from parent of template to the root, which does not extend others.
+		var chain []string
+		for p, ok := parents[name], true; ok; p, ok = parents[p] {
+			if len(chain) >= 10 {
+				return nil, fmt.Errorf("template: %s extends too deep or cyclic", name)
+			}
+			if _, exist := contents[p]; !exist {
+				return nil, fmt.Errorf("template: %s extends undefined template %q", name, p)
+			}
+			chain = append(chain, p)
+		}
+
+		x, err := t.Clone()
+		if err != nil {
+			return nil, err
+		}
+		// Blocks defined later override those defined earlier.
+		for i := len(chain) - 2; i >= 0; i-- {
+			if _, err = x.New(chain[i] + "#blocks").Parse(contents[chain[i]]); err != nil {
+				return nil, err
+			}
+		}
+		if _, err = x.New(name + "#blocks").Parse(contents[name]); err != nil {
+			return nil, err
+		}
+		d := defaultDelims(delims)
+		if _, err = x.New(name).Parse(d.Left + `template "` + chain[len(chain)-1] + `" .` + d.Right); err != nil {
+			return nil, err
+		}
+		extended[name] = x
+	}
+
+	ht := &htmlTemplates{t, extended, mergeFuncs(funcs), make(map[*template.Template]*sync.Pool, len(extended)+1)}
+	ht.pools[t] = newHTMLPool(t)
+	for _, x := range extended {
+		ht.pools[x] = newHTMLPool(x)
+	}
+	return ht, nil
+}
+
+// newHTMLPool returns pool of clones of t. A html/template cannot be cloned once executed,
+// t is never executed so clones are always available.
+func newHTMLPool(t *template.Template) *sync.Pool {
+	return &sync.Pool{New: func() interface{} {
+		return template.Must(t.Clone())
+	}}
+}
+
+func (ht *htmlTemplates) tree(name string) *template.Template {
+	if x, ok := ht.extended[name]; ok {
+		return x
+	}
+	return ht.t
+}
+
+func (ht *htmlTemplates) Lookup(name string) bool {
+	_, ok := ht.extended[name]
+	return ok || ht.t.Lookup(name) != nil
+}
+
+func (ht *htmlTemplates) Execute(w io.Writer, name string, data interface{}, funcs template.FuncMap) error {
+	pool := ht.pools[ht.tree(name)]
+	t := pool.Get().(*template.Template)
+	defer pool.Put(t)
+	if len(funcs) > 0 {
+		t.Funcs(funcs)
+		defer t.Funcs(resetFuncs(ht.funcs, funcs))
+	}
+	return t.ExecuteTemplate(w, name, data)
+}
+
+type textEngine struct{}
+
+// textTemplates are templates parsed by textEngine, executions take clones from pool like htmlTemplates.
+type textTemplates struct {
+	t     *texttemplate.Template
+	funcs template.FuncMap
+	pool  *sync.Pool
+}
+
+func (textEngine) Parse(files []TemplateFile, delims Delims, funcs []template.FuncMap) (Templates, error) {
+	t := texttemplate.New("")
+	t.Delims(delims.Left, delims.Right)
+
+	for _, f := range files {
+		tmpl := t.New(f.Name())
+		for _, fm := range funcs {
+			tmpl.Funcs(texttemplate.FuncMap(fm))
+		}
+		if _, err := tmpl.Parse(string(f.Data())); err != nil {
+			return nil, err
+		}
+	}
+	return &textTemplates{t, mergeFuncs(funcs), &sync.Pool{New: func() interface{} {
+		return texttemplate.Must(t.Clone())
+	}}}, nil
+}
+
+func (tt *textTemplates) Lookup(name string) bool {
+	return tt.t.Lookup(name) != nil
+}
+
+func (tt *textTemplates) Execute(w io.Writer, name string, data interface{}, funcs template.FuncMap) error {
+	t := tt.pool.Get().(*texttemplate.Template)
+	defer tt.pool.Put(t)
+	if len(funcs) > 0 {
+		t.Funcs(texttemplate.FuncMap(funcs))
+		defer t.Funcs(texttemplate.FuncMap(resetFuncs(tt.funcs, funcs)))
+	}
+	return t.ExecuteTemplate(w, name, data)
+}
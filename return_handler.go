@@ -16,6 +16,8 @@
 package bigo
 
 import (
+	"encoding/json"
+	"io"
 	"net/http"
 	"reflect"
 
@@ -26,26 +28,84 @@ import (
 // when a route handler returns something. The ReturnHandler is
 // responsible for writing to the ResponseWriter based on the values
 // that are passed into this function.
+//
+// The default ReturnHandler accepts these return values of handlers:
+//
+//	body
+//	status, body
+//	status, headers(http.Header), body
+//
+// where body is a string, []byte, io.Reader, or value to encode as JSON like struct and map,
+// status alone is also accepted. A non-nil error as last value is responded by its status,
+// see HTTPError, the other values are ignored then.
 type ReturnHandler func(*Context, []reflect.Value)
 
+var (
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	readerType = reflect.TypeOf((*io.Reader)(nil)).Elem()
+	headerType = reflect.TypeOf(http.Header(nil))
+)
+
 func defaultReturnHandler() ReturnHandler {
 	return func(ctx *Context, vals []reflect.Value) {
 		rv := ctx.GetVal(inject.InterfaceOf((*http.ResponseWriter)(nil)))
 		res := rv.Interface().(http.ResponseWriter)
-		var responseVal reflect.Value
-		if len(vals) > 1 && vals[0].Kind() == reflect.Int {
-			res.WriteHeader(int(vals[0].Int()))
-			responseVal = vals[1]
-		} else if len(vals) > 0 {
-			responseVal = vals[0]
+
+		if last := vals[len(vals)-1]; last.Type().Implements(errorType) {
+			if !isNil(last) {
+				err := last.Interface().(error)
+				ctx.HandleError(StatusOf(err), err)
+				return
+			}
+			vals = vals[:len(vals)-1]
+		}
+		if len(vals) == 0 {
+			return
 		}
-		if canDeref(responseVal) {
+
+		status := 0
+		if vals[0].Kind() == reflect.Int {
+			status = int(vals[0].Int())
+			vals = vals[1:]
+		}
+		if len(vals) > 1 && vals[0].Type() == headerType {
+			for k, v := range vals[0].Interface().(http.Header) {
+				res.Header()[k] = v
+			}
+			vals = vals[1:]
+		}
+		if len(vals) == 0 {
+			if status > 0 {
+				res.WriteHeader(status)
+			}
+			return
+		}
+
+		responseVal := vals[0]
+		if responseVal.Kind() == reflect.Interface && !responseVal.IsNil() {
 			responseVal = responseVal.Elem()
 		}
-		if isByteSlice(responseVal) {
-			res.Write(responseVal.Bytes())
-		} else {
-			res.Write([]byte(responseVal.String()))
+		switch {
+		case responseVal.Type().Implements(readerType) && !isNil(responseVal):
+			writeStatus(res, status)
+			r := responseVal.Interface().(io.Reader)
+			io.Copy(res, r)
+			if c, ok := r.(io.Closer); ok {
+				c.Close()
+			}
+		case canDeref(responseVal) && (responseVal.IsNil() || isBody(responseVal.Elem())):
+			writeStatus(res, status)
+			if !responseVal.IsNil() {
+				writeBody(res, responseVal.Elem())
+			}
+		case isBody(responseVal):
+			writeStatus(res, status)
+			writeBody(res, responseVal)
+		default:
+			if status == 0 {
+				status = http.StatusOK
+			}
+			writeJSON(ctx, res, status, responseVal.Interface())
 		}
 	}
 }
@@ -57,3 +117,46 @@ func isByteSlice(val reflect.Value) bool {
 func canDeref(val reflect.Value) bool {
 	return val.Kind() == reflect.Interface || val.Kind() == reflect.Ptr
 }
+
+func isNil(val reflect.Value) bool {
+	switch val.Kind() {
+	case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return val.IsNil()
+	}
+	return false
+}
+
+// isBody returns true if value is written as it is.
+func isBody(val reflect.Value) bool {
+	return val.Kind() == reflect.String || isByteSlice(val)
+}
+
+func writeStatus(res http.ResponseWriter, status int) {
+	if status > 0 {
+		res.WriteHeader(status)
+	}
+}
+
+func writeBody(res http.ResponseWriter, val reflect.Value) {
+	if isByteSlice(val) {
+		res.Write(val.Bytes())
+	} else {
+		res.Write([]byte(val.String()))
+	}
+}
+
+// writeJSON encodes value as JSON by Render if it is in use.
+func writeJSON(ctx *Context, res http.ResponseWriter, status int, v interface{}) {
+	if ctx.Render != nil {
+		ctx.Render.JSON(status, v)
+		return
+	}
+	result, err := json.Marshal(v)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set(ContentType, ContentJSON+"; charset="+defaultCharset)
+	res.WriteHeader(status)
+	res.Write(result)
+}
@@ -15,7 +15,9 @@
 package bigo
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
 
@@ -38,16 +40,18 @@ var (
 // routeMap represents a thread-safe map for route tree.
 type routeMap struct {
 	lock   sync.RWMutex
-	routes map[string]map[string]bool
+	routes map[string]map[string]int // Method -> pattern -> number of handlers.
+	names  map[string]string         // Route name -> pattern.
 }
 
 // NewRouteMap initializes and returns a new routeMap.
 func NewRouteMap() *routeMap {
 	rm := &routeMap{
-		routes: make(map[string]map[string]bool),
+		routes: make(map[string]map[string]int),
+		names:  make(map[string]string),
 	}
 	for m := range _HTTP_METHODS {
-		rm.routes[m] = make(map[string]bool)
+		rm.routes[m] = make(map[string]int)
 	}
 	return rm
 }
@@ -57,15 +61,64 @@ func (rm *routeMap) isExist(method, pattern string) bool {
 	rm.lock.RLock()
 	defer rm.lock.RUnlock()
 
-	return rm.routes[method][pattern]
+	_, ok := rm.routes[method][pattern]
+	return ok
 }
 
-// add adds new route to route tree map.
-func (rm *routeMap) add(method, pattern string) {
+// add adds new route with number of its handlers to route tree map.
+func (rm *routeMap) add(method, pattern string, handlers int) {
 	rm.lock.Lock()
 	defer rm.lock.Unlock()
 
-	rm.routes[method][pattern] = true
+	rm.routes[method][pattern] = handlers
+}
+
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	Method  string `json:"method"`
+	Pattern string `json:"pattern"`
+	// Number of handlers of the route, including those of groups but not middlewares.
+	Handlers int `json:"handlers"`
+}
+
+// list returns all routes sorted by pattern and method.
+func (rm *routeMap) list() []RouteInfo {
+	rm.lock.RLock()
+	defer rm.lock.RUnlock()
+
+	routes := make([]RouteInfo, 0, len(rm.routes)*4)
+	for method, patterns := range rm.routes {
+		for pattern, handlers := range patterns {
+			routes = append(routes, RouteInfo{method, pattern, handlers})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// addName gives a name to the route pattern, it panics if the name has been used by another pattern.
+func (rm *routeMap) addName(name, pattern string) {
+	rm.lock.Lock()
+	defer rm.lock.Unlock()
+
+	if p, ok := rm.names[name]; ok && p != pattern {
+		panic("route with name '" + name + "' has already been registered")
+	}
+	rm.names[name] = pattern
+}
+
+// getPattern returns the route pattern of given name.
+func (rm *routeMap) getPattern(name string) (string, bool) {
+	rm.lock.RLock()
+	defer rm.lock.RUnlock()
+
+	pattern, ok := rm.names[name]
+	return pattern, ok
 }
 
 type group struct {
@@ -79,8 +132,9 @@ type Router struct {
 	routers map[string]*Tree
 	*routeMap
 
-	groups   []group
-	notFound http.HandlerFunc
+	groups           []group
+	notFound         http.HandlerFunc
+	methodNotAllowed http.HandlerFunc
 }
 
 func NewRouter() *Router {
@@ -92,12 +146,44 @@ func NewRouter() *Router {
 
 type Params map[string]string
 
+// Route represents a registered route, which can be named for reverse URL generation.
+type Route struct {
+	router  *Router
+	method  string
+	pattern string
+	groups  []string
+}
+
+// Name sets the name of the route, so that its URL can be built by Router.URLFor.
+func (r *Route) Name(name string) *Route {
+	if len(name) == 0 {
+		panic("route name cannot be empty")
+	}
+	r.router.addName(name, r.pattern)
+	return r
+}
+
+// Method returns the HTTP method of the route, "*" means any method.
+func (r *Route) Method() string {
+	return r.method
+}
+
+// Pattern returns the full pattern of the route, including group prefixes.
+func (r *Route) Pattern() string {
+	return r.pattern
+}
+
+// Groups returns full patterns of groups that the route is registered in, from outermost to innermost.
+func (r *Route) Groups() []string {
+	return r.groups
+}
+
 // Handle is a function that can be registered to a route to handle HTTP requests.
 // Like http.HandlerFunc, but has a third parameter for the values of wildcards (variables).
 type Handle func(http.ResponseWriter, *http.Request, Params)
 
-// handle adds new route to the router tree.
-func (r *Router) handle(method, pattern string, handle Handle) {
+// handle adds new route to the router tree, handlers is the number of handlers of the route.
+func (r *Router) handle(method, pattern string, handlers int, handle Handle) {
 	method = strings.ToUpper(method)
 
 	// Prevent duplicate routes.
@@ -129,17 +215,19 @@ func (r *Router) handle(method, pattern string, handle Handle) {
 			t.AddRouter(pattern, handle)
 			r.routers[m] = t
 		}
-		r.add(m, pattern)
+		r.add(m, pattern, handlers)
 	}
 }
 
 // Handle registers a new request handle with the given pattern, method and handlers.
-func (r *Router) Handle(method string, pattern string, handlers []Handler) {
+func (r *Router) Handle(method string, pattern string, handlers []Handler) *Route {
+	var groups []string
 	if len(r.groups) > 0 {
 		groupPattern := ""
 		h := make([]Handler, 0)
 		for _, g := range r.groups {
 			groupPattern += g.pattern
+			groups = append(groups, groupPattern)
 			h = append(h, g.handlers...)
 		}
 
@@ -149,14 +237,17 @@ func (r *Router) Handle(method string, pattern string, handlers []Handler) {
 	}
 	validateHandlers(handlers)
 
-	r.handle(method, pattern, func(resp http.ResponseWriter, req *http.Request, params Params) {
+	route := &Route{r, strings.ToUpper(method), pattern, groups}
+	r.handle(method, pattern, len(handlers), func(resp http.ResponseWriter, req *http.Request, params Params) {
 		c := r.m.createContext(resp, req)
 		c.params = params
+		c.route = route
 		c.handlers = make([]Handler, 0, len(r.m.handlers)+len(handlers))
 		c.handlers = append(c.handlers, r.m.handlers...)
 		c.handlers = append(c.handlers, handlers...)
 		c.run()
 	})
+	return route
 }
 
 func (r *Router) Group(pattern string, fn func(), h ...Handler) {
@@ -166,58 +257,65 @@ func (r *Router) Group(pattern string, fn func(), h ...Handler) {
 }
 
 // Get is a shortcut for r.Handle("GET", pattern, handlers)
-func (r *Router) Get(pattern string, h ...Handler) {
-	r.Handle("GET", pattern, h)
+func (r *Router) Get(pattern string, h ...Handler) *Route {
+	return r.Handle("GET", pattern, h)
 }
 
 // Patch is a shortcut for r.Handle("PATCH", pattern, handlers)
-func (r *Router) Patch(pattern string, h ...Handler) {
-	r.Handle("PATCH", pattern, h)
+func (r *Router) Patch(pattern string, h ...Handler) *Route {
+	return r.Handle("PATCH", pattern, h)
 }
 
 // Post is a shortcut for r.Handle("POST", pattern, handlers)
-func (r *Router) Post(pattern string, h ...Handler) {
-	r.Handle("POST", pattern, h)
+func (r *Router) Post(pattern string, h ...Handler) *Route {
+	return r.Handle("POST", pattern, h)
 }
 
 // Put is a shortcut for r.Handle("PUT", pattern, handlers)
-func (r *Router) Put(pattern string, h ...Handler) {
-	r.Handle("PUT", pattern, h)
+func (r *Router) Put(pattern string, h ...Handler) *Route {
+	return r.Handle("PUT", pattern, h)
 }
 
 // Delete is a shortcut for r.Handle("DELETE", pattern, handlers)
-func (r *Router) Delete(pattern string, h ...Handler) {
-	r.Handle("DELETE", pattern, h)
+func (r *Router) Delete(pattern string, h ...Handler) *Route {
+	return r.Handle("DELETE", pattern, h)
 }
 
 // Options is a shortcut for r.Handle("OPTIONS", pattern, handlers)
-func (r *Router) Options(pattern string, h ...Handler) {
-	r.Handle("OPTIONS", pattern, h)
+func (r *Router) Options(pattern string, h ...Handler) *Route {
+	return r.Handle("OPTIONS", pattern, h)
 }
 
 // Head is a shortcut for r.Handle("HEAD", pattern, handlers)
-func (r *Router) Head(pattern string, h ...Handler) {
-	r.Handle("HEAD", pattern, h)
+func (r *Router) Head(pattern string, h ...Handler) *Route {
+	return r.Handle("HEAD", pattern, h)
 }
 
 // Any is a shortcut for r.Handle("*", pattern, handlers)
-func (r *Router) Any(pattern string, h ...Handler) {
-	r.Handle("*", pattern, h)
+func (r *Router) Any(pattern string, h ...Handler) *Route {
+	return r.Handle("*", pattern, h)
 }
 
 // Route is a shortcut for same handlers but different HTTP methods.
 //
 // Example:
 // 		m.Route("/", "GET,POST", h)
-func (r *Router) Route(pattern, methods string, h ...Handler) {
+func (r *Router) Route(pattern, methods string, h ...Handler) *Route {
+	var route *Route
 	for _, m := range strings.Split(methods, ",") {
-		r.Handle(strings.TrimSpace(m), pattern, h)
+		route = r.Handle(strings.TrimSpace(m), pattern, h)
 	}
+	return route
 }
 
 // Combo returns a combo router.
 func (r *Router) Combo(pattern string, h ...Handler) *ComboRouter {
-	return &ComboRouter{r, pattern, h, map[string]bool{}}
+	return &ComboRouter{r, pattern, h, map[string]bool{}, nil}
+}
+
+// Routes returns all registered routes sorted by pattern and method.
+func (r *Router) Routes() []RouteInfo {
+	return r.list()
 }
 
 // Configurable http.HandlerFunc which is called when no matching route is
@@ -231,22 +329,170 @@ func (r *Router) NotFound(handlers ...Handler) {
 	}
 }
 
+// Configurable http.HandlerFunc which is called when the requested path
+// matches a route but not for the requested method. The Allow header is set
+// before it is called. If it is not set, a 405 response is written.
+// Be sure to set 405 response code in your handler.
+func (r *Router) MethodNotAllowed(handlers ...Handler) {
+	r.methodNotAllowed = func(rw http.ResponseWriter, req *http.Request) {
+		c := r.m.createContext(rw, req)
+		c.handlers = make([]Handler, 0, len(r.m.handlers)+len(handlers))
+		c.handlers = append(c.handlers, r.m.handlers...)
+		c.handlers = append(c.handlers, handlers...)
+		c.run()
+	}
+}
+
+// URLFor builds the path of the route with given name.
+// Pairs are names and values of the params in the route pattern,
+// a name can be given with or without the leading ':', "*" stands for the splat.
+// It panics if the route does not exist or params do not match the pattern.
+//
+// Example:
+// 		m.Get("/user/:id:int", h).Name("user.show")
+// 		m.URLFor("user.show", ":id", 12) // "/user/12"
+func (r *Router) URLFor(name string, pairs ...interface{}) string {
+	pattern, ok := r.getPattern(name)
+	if !ok {
+		panic("route with name '" + name + "' does not exist")
+	}
+	if len(pairs)%2 != 0 {
+		panic("URLFor: odd number of param pairs for route '" + name + "'")
+	}
+
+	params := make(map[string]string, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key := utl.ToStr(pairs[i])
+		if key == "*" {
+			key = ":splat"
+		} else if !strings.HasPrefix(key, ":") {
+			key = ":" + key
+		}
+		params[key] = utl.ToStr(pairs[i+1])
+	}
+
+	segments := splitPath(pattern)
+	parts := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		part, err := buildSegment(seg, params)
+		if err != nil {
+			panic(fmt.Sprintf("URLFor: route '%s': %v", name, err))
+		}
+		if len(part) > 0 {
+			parts = append(parts, part)
+		}
+	}
+
+	url := "/" + strings.Join(parts, "/")
+	if len(parts) > 0 && strings.HasSuffix(pattern, "/") {
+		url += "/"
+	}
+	if r.m != nil {
+		url = r.m.urlPrefix + url
+	}
+	return url
+}
+
+// AllowedMethods returns sorted HTTP methods that have a route matches given path.
+func (r *Router) AllowedMethods(path string) []string {
+	methods := make([]string, 0, len(r.routers))
+	for m, t := range r.routers {
+		if h, _ := t.Match(path); h != nil {
+			methods = append(methods, m)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// allowHeader returns value of Allow header for given registered methods,
+// HEAD and OPTIONS are included because they are served automatically.
+func allowHeader(methods []string) string {
+	allow := make(map[string]bool, len(methods)+2)
+	for _, m := range methods {
+		allow[m] = true
+	}
+	if allow["GET"] {
+		allow["HEAD"] = true
+	}
+	allow["OPTIONS"] = true
+
+	methods = make([]string, 0, len(allow))
+	for m := range allow {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+// autoOptions answers OPTIONS request of a path that has no OPTIONS route,
+// the middlewares are still called so that they can handle preflight requests.
+func (r *Router) autoOptions(rw http.ResponseWriter, req *http.Request, methods []string) {
+	c := r.m.createContext(rw, req)
+	c.handlers = make([]Handler, 0, len(r.m.handlers)+1)
+	c.handlers = append(c.handlers, r.m.handlers...)
+	c.handlers = append(c.handlers, func(ctx *Context) {
+		ctx.Resp.Header().Set("Allow", allowHeader(methods))
+		ctx.Resp.WriteHeader(http.StatusNoContent)
+	})
+	c.run()
+}
+
+// headResponseWriter discards response body of HEAD request served by GET route.
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// match finds handle of given method and path, and fills splat params.
+func (r *Router) match(method, path string) (Handle, Params) {
+	t, ok := r.routers[method]
+	if !ok {
+		return nil, nil
+	}
+
+	h, p := t.Match(path)
+	if h == nil {
+		return nil, nil
+	}
+	if splat, ok := p[":splat"]; ok {
+		p["*"] = p[":splat"] // Better name.
+		splatlist := strings.Split(splat, "/")
+		for k, v := range splatlist {
+			p[utl.ToStr(k)] = v
+		}
+	}
+	return h, p
+}
+
 func (r *Router) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
-	if t, ok := r.routers[req.Method]; ok {
-		h, p := t.Match(req.URL.Path)
-		if h != nil {
-			if splat, ok := p[":splat"]; ok {
-				p["*"] = p[":splat"] // Better name.
-				splatlist := strings.Split(splat, "/")
-				for k, v := range splatlist {
-					p[utl.ToStr(k)] = v
-				}
-			}
-			h(rw, req, p)
+	if h, p := r.match(req.Method, req.URL.Path); h != nil {
+		h(rw, req, p)
+		return
+	}
+
+	// Serve HEAD request by GET route when there is no HEAD route.
+	if req.Method == "HEAD" {
+		if h, p := r.match("GET", req.URL.Path); h != nil {
+			h(headResponseWriter{rw}, req, p)
 			return
 		}
 	}
 
+	if methods := r.AllowedMethods(req.URL.Path); len(methods) > 0 {
+		if req.Method == "OPTIONS" {
+			r.autoOptions(rw, req, methods)
+			return
+		}
+
+		rw.Header().Set("Allow", allowHeader(methods))
+		r.methodNotAllowed(rw, req)
+		return
+	}
+
 	r.notFound(rw, req)
 }
 
@@ -256,6 +502,7 @@ type ComboRouter struct {
 	pattern  string
 	handlers []Handler
 	methods  map[string]bool // Registered methods.
+	last     *Route          // Last registered route.
 }
 
 func (cr *ComboRouter) checkMethod(name string) {
@@ -265,9 +512,9 @@ func (cr *ComboRouter) checkMethod(name string) {
 	cr.methods[name] = true
 }
 
-func (cr *ComboRouter) route(fn func(string, ...Handler), method string, h ...Handler) *ComboRouter {
+func (cr *ComboRouter) route(fn func(string, ...Handler) *Route, method string, h ...Handler) *ComboRouter {
 	cr.checkMethod(method)
-	fn(cr.pattern, append(cr.handlers, h...)...)
+	cr.last = fn(cr.pattern, append(cr.handlers, h...)...)
 	return cr
 }
 
@@ -298,3 +545,13 @@ func (cr *ComboRouter) Options(h ...Handler) *ComboRouter {
 func (cr *ComboRouter) Head(h ...Handler) *ComboRouter {
 	return cr.route(cr.router.Head, "HEAD", h...)
 }
+
+// Name sets the name of the combo router pattern, see Route.Name.
+// It must be called after at least one method has been registered.
+func (cr *ComboRouter) Name(name string) *ComboRouter {
+	if cr.last == nil {
+		panic("no method has been registered for combo router '" + cr.pattern + "'")
+	}
+	cr.last.Name(name)
+	return cr
+}
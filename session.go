@@ -0,0 +1,407 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package bigo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// RawStore is the interface that operates the session data.
+type RawStore interface {
+	// Set sets value to given key in session.
+	Set(key, value interface{}) error
+	// Get gets value by given key in session.
+	Get(key interface{}) interface{}
+	// Delete deletes a key from session.
+	Delete(key interface{}) error
+	// ID returns current session ID.
+	ID() string
+	// Release releases session resource and save data to provider.
+	Release() error
+	// Flush deletes all session data.
+	Flush() error
+}
+
+// Session is the interface that contains all data for one session process with specific ID.
+type Session interface {
+	RawStore
+	// Read returns raw session store by session ID.
+	Read(sid string) (RawStore, error)
+	// Destroy deletes a session.
+	Destroy(*Context) error
+	// RegenerateId regenerates a session store from old session ID to new one.
+	RegenerateId(*Context) (RawStore, error)
+	// Count counts and returns number of sessions.
+	Count() int
+	// GC calls GC to clean expired sessions.
+	GC()
+}
+
+// SessionProvider is the interface that provides session manipulations.
+type SessionProvider interface {
+	// Init initializes session provider.
+	Init(maxlifetime int64, config string) error
+	// Read returns raw session store by session ID.
+	Read(sid string) (RawStore, error)
+	// Exist returns true if session with given ID exists.
+	Exist(sid string) bool
+	// Destroy deletes a session by session ID.
+	Destroy(sid string) error
+	// Regenerate regenerates a session store from old session ID to new one.
+	Regenerate(oldsid, sid string) (RawStore, error)
+	// Count counts and returns number of sessions.
+	Count() int
+	// GC calls GC to clean expired sessions.
+	GC()
+}
+
+// cookieValuer is implemented by raw stores that keep all data in the
+// session cookie itself, the value is written back before response is sent.
+type cookieValuer interface {
+	cookieValue() (string, error)
+}
+
+var sessionProviders = make(map[string]SessionProvider)
+
+// RegisterSessionProvider registers a session provider by given name,
+// it panics if the name is registered twice or provider is nil.
+func RegisterSessionProvider(name string, provider SessionProvider) {
+	if provider == nil {
+		panic("session: cannot register provider with nil value")
+	}
+	if _, dup := sessionProviders[name]; dup {
+		panic(fmt.Errorf("session: cannot register provider '%s' twice", name))
+	}
+	sessionProviders[name] = provider
+}
+
+// SessionOptions represents a struct for specifying configuration options for the session middleware.
+type SessionOptions struct {
+	// Name of provider. Default is "memory".
+	Provider string
+	// Provider configuration, it's corresponding to provider.
+	// For "file" it is the directory to save session files, default is "data/sessions".
+	// For "cookie" it is comma separated secrets to encode cookie, default is the secure cookie secrets which must be set then.
+	ProviderConfig string
+	// Cookie name to save session ID. Default is "BigoSession".
+	CookieName string
+	// Cookie path to store. Default is "/".
+	CookiePath string
+	// Cookie domain. Default is empty.
+	Domain string
+	// Whether set cookie with secure flag. Default is false.
+	Secure bool
+	// Cookie life time in seconds, 0 means a browser session cookie. Default is 0.
+	CookieLifeTime int
+	// GC interval time in seconds. Default is 3600.
+	Gclifetime int64
+	// Max life time of a session in seconds. Default is whatever GC interval time is.
+	Maxlifetime int64
+	// Length of random bytes used by session ID. Default is 16.
+	IDLength int
+}
+
+func prepareSessionOptions(options []SessionOptions) SessionOptions {
+	var opt SessionOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+
+	conf := GetConfig().Session
+	if conf == nil {
+		conf = &SessionOpt{}
+	}
+
+	if len(opt.Provider) == 0 {
+		opt.Provider = conf.Provider
+	}
+	if len(opt.Provider) == 0 {
+		opt.Provider = "memory"
+	}
+	if len(opt.ProviderConfig) == 0 {
+		opt.ProviderConfig = conf.ProviderConfig
+	}
+	if len(opt.CookieName) == 0 {
+		opt.CookieName = conf.CookieName
+	}
+	if len(opt.CookieName) == 0 {
+		opt.CookieName = "BigoSession"
+	}
+	if len(opt.CookiePath) == 0 {
+		opt.CookiePath = conf.CookiePath
+	}
+	if len(opt.CookiePath) == 0 {
+		opt.CookiePath = "/"
+	}
+	if len(opt.Domain) == 0 {
+		opt.Domain = conf.Domain
+	}
+	if !opt.Secure {
+		opt.Secure = conf.Secure
+	}
+	if opt.CookieLifeTime == 0 {
+		opt.CookieLifeTime = conf.CookieLifeTime
+	}
+	if opt.Gclifetime == 0 {
+		opt.Gclifetime = conf.Gclifetime
+	}
+	if opt.Gclifetime == 0 {
+		opt.Gclifetime = 3600
+	}
+	if opt.Maxlifetime == 0 {
+		opt.Maxlifetime = conf.Maxlifetime
+	}
+	if opt.Maxlifetime == 0 {
+		opt.Maxlifetime = opt.Gclifetime
+	}
+	if opt.IDLength == 0 {
+		opt.IDLength = conf.IDLength
+	}
+	if opt.IDLength == 0 {
+		opt.IDLength = 16
+	}
+
+	return opt
+}
+
+// SessionManager represents a struct that contains session provider and its configuration.
+type SessionManager struct {
+	provider SessionProvider
+	opt      SessionOptions
+
+	gcOnce    sync.Once
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewSessionManager creates and returns a new session manager by given provider name and configuration.
+func NewSessionManager(name string, opt SessionOptions) (*SessionManager, error) {
+	p, ok := sessionProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("session: unknown provider '%s'(forgotten import?)", name)
+	}
+	return &SessionManager{provider: p, opt: opt, closed: make(chan struct{})}, p.Init(opt.Maxlifetime, opt.ProviderConfig)
+}
+
+// sessionId generates a new random session ID in hex form.
+func (m *SessionManager) sessionId() string {
+	b := make([]byte, m.opt.IDLength)
+	if _, err := rand.Read(b); err != nil {
+		panic("session: fail to generate ID: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// setCookie writes session cookie with given value and max age.
+func (m *SessionManager) setCookie(ctx *Context, value string, maxAge int) {
+	cookie := &http.Cookie{
+		Name:     m.opt.CookieName,
+		Value:    url.QueryEscape(value),
+		Path:     m.opt.CookiePath,
+		Domain:   m.opt.Domain,
+		Secure:   m.opt.Secure,
+		HttpOnly: true,
+		MaxAge:   maxAge,
+	}
+	if maxAge > 0 {
+		cookie.Expires = time.Now().Add(time.Duration(maxAge) * time.Second)
+	}
+	http.SetCookie(ctx.Resp, cookie)
+}
+
+// Start starts a session by reading session ID from cookie, or generates a new one.
+func (m *SessionManager) Start(ctx *Context) (RawStore, error) {
+	sid := ctx.GetCookie(m.opt.CookieName)
+	if len(sid) > 0 && m.provider.Exist(sid) {
+		return m.provider.Read(sid)
+	}
+
+	sid = m.sessionId()
+	sess, err := m.provider.Read(sid)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := sess.(cookieValuer); !ok {
+		m.setCookie(ctx, sid, m.opt.CookieLifeTime)
+	}
+	return sess, nil
+}
+
+// Read returns raw session store by session ID.
+func (m *SessionManager) Read(sid string) (RawStore, error) {
+	return m.provider.Read(sid)
+}
+
+// Destroy deletes a session by given ID and expires the session cookie.
+func (m *SessionManager) Destroy(ctx *Context) error {
+	sid := ctx.GetCookie(m.opt.CookieName)
+	if len(sid) == 0 {
+		return nil
+	}
+
+	if err := m.provider.Destroy(sid); err != nil {
+		return err
+	}
+	m.setCookie(ctx, "", -1)
+	return nil
+}
+
+// RegenerateId regenerates a session store from old session ID to new one,
+// data of old session is kept.
+func (m *SessionManager) RegenerateId(ctx *Context) (sess RawStore, err error) {
+	sid := m.sessionId()
+	oldsid := ctx.GetCookie(m.opt.CookieName)
+	sess, err = m.provider.Regenerate(oldsid, sid)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := sess.(cookieValuer); !ok {
+		m.setCookie(ctx, sid, m.opt.CookieLifeTime)
+	}
+	return sess, nil
+}
+
+// Count counts and returns number of sessions.
+func (m *SessionManager) Count() int {
+	return m.provider.Count()
+}
+
+// GC calls GC to clean expired sessions.
+func (m *SessionManager) GC() {
+	m.provider.GC()
+}
+
+// StartGC starts GC job in a certain period until Close is called, calls after the first one do nothing.
+func (m *SessionManager) StartGC() {
+	m.gcOnce.Do(func() {
+		m.GC()
+		if m.opt.Gclifetime <= 0 {
+			return
+		}
+		go func() {
+			ticker := time.NewTicker(time.Duration(m.opt.Gclifetime) * time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					m.GC()
+				case <-m.closed:
+					return
+				}
+			}
+		}()
+	})
+}
+
+// Close stops GC job of the manager.
+func (m *SessionManager) Close() {
+	m.closeOnce.Do(func() {
+		close(m.closed)
+	})
+}
+
+// store represents a session store with manager, it is mapped as Session into request context.
+type store struct {
+	RawStore
+	*SessionManager
+	destroyed bool
+}
+
+var _ Session = &store{}
+
+// Destroy deletes current session, its data will not be saved on release.
+func (s *store) Destroy(ctx *Context) error {
+	if err := s.SessionManager.Destroy(ctx); err != nil {
+		return err
+	}
+	s.destroyed = true
+	return nil
+}
+
+// RegenerateId regenerates session ID and replaces the store used by current request.
+func (s *store) RegenerateId(ctx *Context) (RawStore, error) {
+	sess, err := s.SessionManager.RegenerateId(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.RawStore = sess
+	s.destroyed = false
+	return sess, nil
+}
+
+// writeCookie saves whole session data into cookie for cookie based stores.
+func (s *store) writeCookie(ctx *Context) {
+	cv, ok := s.RawStore.(cookieValuer)
+	if !ok || s.destroyed {
+		return
+	}
+	val, err := cv.cookieValue()
+	if err != nil {
+		panic("session: fail to encode cookie: " + err.Error())
+	}
+	s.setCookie(ctx, val, s.opt.CookieLifeTime)
+}
+
+// Sessioner is a middleware that maps a Session service into the Bigo handler chain.
+// An single variadic SessionOptions struct can be optionally provided to configure.
+// GC job starts on the first request and stops when the Bigo instance shuts down.
+func Sessioner(options ...SessionOptions) Handler {
+	opt := prepareSessionOptions(options)
+	manager, err := NewSessionManager(opt.Provider, opt)
+	if err != nil {
+		panic(err)
+	}
+
+	var once sync.Once
+	return func(ctx *Context) {
+		once.Do(func() {
+			if ctx.Router != nil && ctx.Router.m != nil {
+				ctx.Router.m.OnShutdown(manager.Close)
+			}
+			manager.StartGC()
+		})
+
+		sess, err := manager.Start(ctx)
+		if err != nil {
+			panic("session: " + err.Error())
+		}
+
+		s := &store{RawStore: sess, SessionManager: manager}
+		ctx.MapTo(s, (*Session)(nil))
+
+		// Cookie based stores must be saved before any header is sent.
+		ctx.Resp.Before(func(ResponseWriter) {
+			s.writeCookie(ctx)
+		})
+
+		ctx.Next()
+
+		if !ctx.Written() {
+			s.writeCookie(ctx)
+		}
+		if s.destroyed {
+			return
+		}
+		if err = s.Release(); err != nil {
+			panic("session: " + err.Error())
+		}
+	}
+}
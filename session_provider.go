@@ -0,0 +1,487 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package bigo
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fym201/bigo/utl"
+)
+
+func init() {
+	RegisterSessionProvider("memory", &MemSessionProvider{})
+	RegisterSessionProvider("file", &FileSessionProvider{})
+	RegisterSessionProvider("cookie", &CookieSessionProvider{})
+}
+
+// encodeSessionData encodes session data with gob, custom types stored
+// in session must be registered by gob.Register first.
+func encodeSessionData(data map[interface{}]interface{}) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	err := gob.NewEncoder(buf).Encode(data)
+	return buf.Bytes(), err
+}
+
+// decodeSessionData decodes session data encoded by encodeSessionData.
+func decodeSessionData(b []byte) (map[interface{}]interface{}, error) {
+	data := make(map[interface{}]interface{})
+	err := gob.NewDecoder(bytes.NewBuffer(b)).Decode(&data)
+	return data, err
+}
+
+// isValidSessionId returns true if given ID is in the form of generated ones,
+// it prevents malformed IDs from being used as file paths.
+func isValidSessionId(sid string) bool {
+	if len(sid) < 2 {
+		return false
+	}
+	_, err := hex.DecodeString(sid)
+	return err == nil
+}
+
+// mapStore is a raw store keeps session data in a map.
+type mapStore struct {
+	sid  string
+	lock sync.RWMutex
+	data map[interface{}]interface{}
+}
+
+// Set sets value to given key in session.
+func (s *mapStore) Set(key, val interface{}) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.data[key] = val
+	return nil
+}
+
+// Get gets value by given key in session.
+func (s *mapStore) Get(key interface{}) interface{} {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.data[key]
+}
+
+// Delete deletes a key from session.
+func (s *mapStore) Delete(key interface{}) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.data, key)
+	return nil
+}
+
+// ID returns current session ID.
+func (s *mapStore) ID() string {
+	return s.sid
+}
+
+// Release does nothing, data is kept in memory.
+func (s *mapStore) Release() error {
+	return nil
+}
+
+// Flush deletes all session data.
+func (s *mapStore) Flush() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.data = make(map[interface{}]interface{})
+	return nil
+}
+
+// memStore represents a in-memory session store.
+type memStore struct {
+	mapStore
+	lastAccess time.Time
+}
+
+// MemSessionProvider represents a in-memory session provider implementation.
+type MemSessionProvider struct {
+	lock        sync.RWMutex
+	maxlifetime int64
+	data        map[string]*memStore
+}
+
+// Init initializes memory session provider.
+func (p *MemSessionProvider) Init(maxlifetime int64, _ string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.maxlifetime = maxlifetime
+	p.data = make(map[string]*memStore)
+	return nil
+}
+
+// Read returns raw session store by session ID.
+func (p *MemSessionProvider) Read(sid string) (RawStore, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	s, ok := p.data[sid]
+	if !ok {
+		s = &memStore{mapStore: mapStore{sid: sid, data: make(map[interface{}]interface{})}}
+		p.data[sid] = s
+	}
+	s.lastAccess = time.Now()
+	return s, nil
+}
+
+// Exist returns true if session with given ID exists.
+func (p *MemSessionProvider) Exist(sid string) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	_, ok := p.data[sid]
+	return ok
+}
+
+// Destroy deletes a session by session ID.
+func (p *MemSessionProvider) Destroy(sid string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	delete(p.data, sid)
+	return nil
+}
+
+// Regenerate regenerates a session store from old session ID to new one.
+func (p *MemSessionProvider) Regenerate(oldsid, sid string) (RawStore, error) {
+	p.lock.Lock()
+	s, ok := p.data[oldsid]
+	if ok {
+		delete(p.data, oldsid)
+		s.sid = sid
+		s.lastAccess = time.Now()
+		p.data[sid] = s
+	}
+	p.lock.Unlock()
+
+	if !ok {
+		return p.Read(sid)
+	}
+	return s, nil
+}
+
+// Count counts and returns number of sessions.
+func (p *MemSessionProvider) Count() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return len(p.data)
+}
+
+// GC calls GC to clean expired sessions.
+func (p *MemSessionProvider) GC() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for sid, s := range p.data {
+		if s.lastAccess.Unix()+p.maxlifetime < time.Now().Unix() {
+			delete(p.data, sid)
+		}
+	}
+}
+
+// fileStore represents a file session store.
+type fileStore struct {
+	mapStore
+	p *FileSessionProvider
+}
+
+// Release saves session data to file.
+func (s *fileStore) Release() error {
+	s.lock.RLock()
+	data, err := encodeSessionData(s.data)
+	s.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+	return s.p.write(s.sid, data)
+}
+
+// FileSessionProvider represents a file session provider implementation.
+type FileSessionProvider struct {
+	lock        sync.RWMutex
+	maxlifetime int64
+	rootPath    string
+}
+
+// Init initializes file session provider with given root path.
+func (p *FileSessionProvider) Init(maxlifetime int64, rootPath string) error {
+	if len(rootPath) == 0 {
+		rootPath = "data/sessions"
+	}
+	p.maxlifetime = maxlifetime
+	p.rootPath = rootPath
+	return os.MkdirAll(rootPath, 0700)
+}
+
+func (p *FileSessionProvider) filepath(sid string) string {
+	return filepath.Join(p.rootPath, string(sid[0]), string(sid[1]), sid)
+}
+
+func (p *FileSessionProvider) write(sid string, data []byte) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	filename := p.filepath(sid)
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0600)
+}
+
+// Read returns raw session store by session ID.
+func (p *FileSessionProvider) Read(sid string) (RawStore, error) {
+	if !isValidSessionId(sid) {
+		return nil, errors.New("invalid session ID: " + sid)
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	filename := p.filepath(sid)
+	data := make(map[interface{}]interface{})
+	if utl.IsFile(filename) {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > 0 {
+			if data, err = decodeSessionData(b); err != nil {
+				return nil, err
+			}
+		}
+		now := time.Now()
+		os.Chtimes(filename, now, now)
+	}
+	return &fileStore{mapStore{sid: sid, data: data}, p}, nil
+}
+
+// Exist returns true if session with given ID exists.
+func (p *FileSessionProvider) Exist(sid string) bool {
+	if !isValidSessionId(sid) {
+		return false
+	}
+
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return utl.IsFile(p.filepath(sid))
+}
+
+// Destroy deletes a session by session ID.
+func (p *FileSessionProvider) Destroy(sid string) error {
+	if !isValidSessionId(sid) {
+		return nil
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	err := os.Remove(p.filepath(sid))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Regenerate regenerates a session store from old session ID to new one.
+func (p *FileSessionProvider) Regenerate(oldsid, sid string) (RawStore, error) {
+	if p.Exist(oldsid) {
+		p.lock.Lock()
+		filename := p.filepath(sid)
+		err := os.MkdirAll(filepath.Dir(filename), 0700)
+		if err == nil {
+			err = os.Rename(p.filepath(oldsid), filename)
+		}
+		p.lock.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p.Read(sid)
+}
+
+// Count counts and returns number of sessions.
+func (p *FileSessionProvider) Count() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	count := 0
+	filepath.Walk(p.rootPath, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			count++
+		}
+		return nil
+	})
+	return count
+}
+
+// GC calls GC to clean expired sessions.
+func (p *FileSessionProvider) GC() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	expired := time.Now().Unix() - p.maxlifetime
+	filepath.Walk(p.rootPath, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() && fi.ModTime().Unix() < expired {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
+
+// cookieStore represents a session store that keeps all data in cookie.
+type cookieStore struct {
+	mapStore
+	p *CookieSessionProvider
+}
+
+// cookieValue encodes session ID, issue time and data into cookie value.
+func (s *cookieStore) cookieValue() (string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.p.encode(s.sid, s.data)
+}
+
+// CookieSessionProvider represents a session provider that encrypts whole
+// session data into client cookie, nothing is kept on server side.
+type CookieSessionProvider struct {
+	maxlifetime int64
+	codec       *CookieCodec
+}
+
+// Init initializes cookie session provider with given comma separated secrets,
+// the first one encodes cookie and all of them decode. The default secure
+// cookie secrets are used when it is empty, it returns error if none of them
+// is set because anyone could forge sessions encrypted with an empty key.
+func (p *CookieSessionProvider) Init(maxlifetime int64, secrets string) error {
+	p.maxlifetime = maxlifetime
+	p.codec = nil
+	if len(secrets) == 0 {
+		if !defaultCookieCodec.hasSecret() {
+			return errors.New("session: cookie secret is required, set it in ProviderConfig or by SetDefaultCookieSecret")
+		}
+		return nil
+	}
+
+	keys := strings.Split(secrets, ",")
+	for _, key := range keys {
+		if len(key) == 0 {
+			return errors.New("session: cookie secret cannot be empty")
+		}
+	}
+	p.codec = NewCookieCodec(keys...)
+	p.codec.MaxAge = maxlifetime
+	return nil
+}
+
+func (p *CookieSessionProvider) getCodec() *CookieCodec {
+	if p.codec != nil {
+		return p.codec
+	}
+	codec := *defaultCookieCodec
+	codec.MaxAge = p.maxlifetime
+	codec.AllowLegacy = false
+	return &codec
+}
+
+// cookieSessionData is the value encoded into session cookie.
+type cookieSessionData struct {
+	ID   string
+	Data []byte
+}
+
+func (p *CookieSessionProvider) encode(sid string, data map[interface{}]interface{}) (string, error) {
+	b, err := encodeSessionData(data)
+	if err != nil {
+		return "", err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err = gob.NewEncoder(buf).Encode(cookieSessionData{sid, b}); err != nil {
+		return "", err
+	}
+	return p.getCodec().Encode("session", buf.String())
+}
+
+func (p *CookieSessionProvider) decode(val string) (*cookieStore, bool) {
+	text, err := p.getCodec().Decode("session", val)
+	if err != nil {
+		return nil, false
+	}
+
+	var cd cookieSessionData
+	if err := gob.NewDecoder(bytes.NewBufferString(text)).Decode(&cd); err != nil {
+		return nil, false
+	}
+
+	data, err := decodeSessionData(cd.Data)
+	if err != nil {
+		return nil, false
+	}
+	return &cookieStore{mapStore{sid: cd.ID, data: data}, p}, true
+}
+
+// Read returns raw session store by cookie value, a new empty
+// session with given ID is returned when it cannot be decoded.
+func (p *CookieSessionProvider) Read(sid string) (RawStore, error) {
+	if s, ok := p.decode(sid); ok {
+		return s, nil
+	}
+	return &cookieStore{mapStore{sid: sid, data: make(map[interface{}]interface{})}, p}, nil
+}
+
+// Exist returns true if given cookie value can be decoded and is not expired.
+func (p *CookieSessionProvider) Exist(sid string) bool {
+	_, ok := p.decode(sid)
+	return ok
+}
+
+// Destroy does nothing, session cookie is expired by manager.
+func (p *CookieSessionProvider) Destroy(sid string) error {
+	return nil
+}
+
+// Regenerate keeps data of old cookie value with new session ID.
+func (p *CookieSessionProvider) Regenerate(oldsid, sid string) (RawStore, error) {
+	s, ok := p.decode(oldsid)
+	if !ok {
+		return p.Read(sid)
+	}
+	s.sid = sid
+	return s, nil
+}
+
+// Count always returns 0 because sessions are kept by clients.
+func (p *CookieSessionProvider) Count() int {
+	return 0
+}
+
+// GC does nothing, expired cookies are rejected on read.
+func (p *CookieSessionProvider) GC() {}
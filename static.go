@@ -16,11 +16,25 @@
 package bigo
 
 import (
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
+	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 // StaticOptions is a struct for specifying configuration options for the macaron.Static middleware.
@@ -36,6 +50,105 @@ type StaticOptions struct {
 	Expires func() string
 	// FileSystem is the interface for supporting any implmentation of file system.
 	FileSystem http.FileSystem
+	// Minify enables minifying files that have a registered minifier, results are cached until files are modified.
+	Minify bool
+	// GzipExtensions are extensions of files to be served compressed, e.g. ".js".
+	// Sibling files with ".br" or ".gz" suffix are served if present, otherwise
+	// files are compressed with gzip once and cached until they are modified.
+	GzipExtensions []string
+	// ETag enables ETag header, which is SHA-1 of content unless WeakETag is true.
+	ETag bool
+	// WeakETag makes ETag weak and generated from modification time and size, which is cheaper for large files.
+	WeakETag bool
+	// CacheControl maps path prefixes like "/img/", extensions like ".js" or "*" for other files
+	// to values of Cache-Control header. Longest matched path prefix takes precedence over extension.
+	CacheControl map[string]string
+	// Fingerprint enables serving file like "app.js" by URL with content hash like "app.3f9a1c0b.js"
+	// with immutable caching, URLs are generated by Asset or template function "asset".
+	Fingerprint bool
+	// Listing enables listing directories without index file, in HTML or in JSON if client asks for it.
+	Listing bool
+	// ShowHidden shows files start with "." in directory listing.
+	ShowHidden bool
+	// ListingTemplate renders directory listing in HTML with *DirListing. Default is DefaultListingTemplate.
+	ListingTemplate *template.Template
+	// CacheSize is the max total bytes of minified and compressed files kept in memory,
+	// least recently used ones are evicted first. Default is 32 MB.
+	CacheSize int64
+
+	cache *staticCache
+}
+
+// staticCacheEntry is a transformed static file.
+type staticCacheEntry struct {
+	key     string
+	modTime time.Time
+	data    []byte
+}
+
+// staticCache keeps transformed static files in memory, e.g. minified or compressed,
+// entries are invalidated when files are modified. Total size of entries is limited
+// by maxSize, least recently used entries are evicted.
+type staticCache struct {
+	lock    sync.Mutex
+	maxSize int64
+	size    int64
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+func newStaticCache(maxSize int64) *staticCache {
+	return &staticCache{maxSize: maxSize, lru: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// get returns transformed content by key, read is only called when cache is missed.
+// Original content is cached if transform is nil or fails.
+func (c *staticCache) get(key string, modTime time.Time, transform func([]byte) ([]byte, error), read func() ([]byte, error)) ([]byte, error) {
+	c.lock.Lock()
+	if el, ok := c.entries[key]; ok && el.Value.(*staticCacheEntry).modTime.Equal(modTime) {
+		c.lru.MoveToFront(el)
+		c.lock.Unlock()
+		return el.Value.(*staticCacheEntry).data, nil
+	}
+	c.lock.Unlock()
+
+	data, err := read()
+	if err != nil {
+		return nil, err
+	}
+	if transform != nil {
+		if out, err := transform(data); err == nil {
+			data = out
+		}
+	}
+
+	c.put(&staticCacheEntry{key, modTime, data})
+	return data, nil
+}
+
+// put adds or replaces entry, and evicts least recently used entries if cache is full.
+// Entry larger than the cache is not kept.
+func (c *staticCache) put(e *staticCacheEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if el, ok := c.entries[e.key]; ok {
+		c.remove(el)
+	}
+	if int64(len(e.data)) > c.maxSize {
+		return
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.size += int64(len(e.data))
+	for c.size > c.maxSize {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *staticCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*staticCacheEntry)
+	delete(c.entries, e.key)
+	c.size -= int64(len(e.data))
 }
 
 // FIXME: to be deleted.
@@ -102,6 +215,18 @@ func prepareStaticOption(dir string, opt StaticOptions) StaticOptions {
 	if opt.FileSystem == nil {
 		opt.FileSystem = newStaticFileSystem(dir)
 	}
+	exts := make([]string, len(opt.GzipExtensions))
+	for i, ext := range opt.GzipExtensions {
+		if len(ext) > 0 && ext[0] != '.' {
+			ext = "." + ext
+		}
+		exts[i] = strings.ToLower(ext)
+	}
+	opt.GzipExtensions = exts
+	if opt.CacheSize <= 0 {
+		opt.CacheSize = 32 << 20
+	}
+	opt.cache = newStaticCache(opt.CacheSize)
 	return opt
 }
 
@@ -131,6 +256,13 @@ func staticHandler(ctx *Context, log *Logger, opt StaticOptions) bool {
 	}
 
 	f, err := opt.FileSystem.Open(file)
+	fingerprint := ""
+	if err != nil && opt.Fingerprint {
+		if orig, sum := splitFingerprint(file); len(orig) > 0 {
+			f, err = opt.FileSystem.Open(orig)
+			file, fingerprint = orig, sum
+		}
+	}
 	if err != nil {
 		return false
 	}
@@ -141,6 +273,16 @@ func staticHandler(ctx *Context, log *Logger, opt StaticOptions) bool {
 		return true // File exists but fail to open.
 	}
 
+	// Fingerprint of stale URL is ignored, and file is served without immutable caching.
+	if len(fingerprint) > 0 {
+		if fi.IsDir() {
+			return false
+		}
+		if sum, err := opt.sum(file, fi.ModTime(), f); err != nil || !strings.HasPrefix(sum, fingerprint) {
+			fingerprint = ""
+		}
+	}
+
 	// Try to serve index file
 	if fi.IsDir() {
 		// Redirect if missing trailing slash.
@@ -149,12 +291,17 @@ func staticHandler(ctx *Context, log *Logger, opt StaticOptions) bool {
 			return true
 		}
 
-		file = path.Join(file, opt.IndexFile)
-		f, err = opt.FileSystem.Open(file)
+		dir := f
+		f, err = opt.FileSystem.Open(path.Join(file, opt.IndexFile))
 		if err != nil {
+			if opt.Listing {
+				serveListing(ctx, log, opt, file, dir)
+				return true
+			}
 			return false // Discard error.
 		}
 		defer f.Close()
+		file = path.Join(file, opt.IndexFile)
 
 		fi, err = f.Stat()
 		if err != nil || fi.IsDir() {
@@ -170,14 +317,280 @@ func staticHandler(ctx *Context, log *Logger, opt StaticOptions) bool {
 	if opt.Expires != nil {
 		ctx.Resp.Header().Set("Expires", opt.Expires())
 	}
+	if len(fingerprint) > 0 {
+		ctx.Resp.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else if cc := opt.cacheControl(file); len(cc) > 0 {
+		ctx.Resp.Header().Set("Cache-Control", cc)
+	}
+
+	var minify MinifyFunc
+	if opt.Minify {
+		minify = getMinifier(mime.TypeByExtension(path.Ext(file)))
+	}
+	if opt.isGzipExtension(file) {
+		ctx.Resp.Header().Add(HeaderVary, HeaderAcceptEncoding)
+		if serveCompressed(ctx, opt, file, fi, minify) {
+			return true
+		}
+	}
+
+	if minify != nil {
+		data, err := opt.cache.get(file+"#min", fi.ModTime(), minify, func() ([]byte, error) {
+			return ioutil.ReadAll(f)
+		})
+		if err == nil {
+			skipMinify(ctx)
+			opt.serveContent(ctx, file, file+"#min", fi.ModTime(), int64(len(data)), bytes.NewReader(data))
+			return true
+		}
+	}
+
+	opt.serveContent(ctx, file, file, fi.ModTime(), fi.Size(), f)
+	return true
+}
+
+// serveContent serves a representation of file, key identifies the representation in cache.
+func (opt *StaticOptions) serveContent(ctx *Context, file, key string, modTime time.Time, size int64, content io.ReadSeeker) {
+	if opt.ETag {
+		if tag, err := opt.etag(key, modTime, size, content); err == nil {
+			ctx.Resp.Header().Set("ETag", tag)
+		}
+	}
+	http.ServeContent(ctx.Resp, ctx.Req.Request, file, modTime, content)
+}
+
+// etag returns ETag of a representation of file.
+func (opt *StaticOptions) etag(key string, modTime time.Time, size int64, content io.ReadSeeker) (string, error) {
+	if opt.WeakETag {
+		return fmt.Sprintf(`W/"%x-%x"`, modTime.UnixNano(), size), nil
+	}
+	sum, err := opt.sum(key, modTime, content)
+	if err != nil {
+		return "", err
+	}
+	return `"` + sum + `"`, nil
+}
+
+// sum returns hex encoded SHA-1 of content, it is cached until modified.
+// Content is rewound after read.
+func (opt *StaticOptions) sum(key string, modTime time.Time, content io.ReadSeeker) (string, error) {
+	data, err := opt.cache.get(key+"#sum", modTime, nil, func() ([]byte, error) {
+		h := sha1.New()
+		if _, err := io.Copy(h, content); err != nil {
+			return nil, err
+		}
+		if _, err := content.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return []byte(hex.EncodeToString(h.Sum(nil))), nil
+	})
+	return string(data), err
+}
+
+// cacheControl returns value of Cache-Control header for file.
+func (opt *StaticOptions) cacheControl(file string) string {
+	match, value := "", ""
+	for k, v := range opt.CacheControl {
+		if strings.HasPrefix(k, "/") && strings.HasPrefix(file, k) && len(k) > len(match) {
+			match, value = k, v
+		}
+	}
+	if len(match) > 0 {
+		return value
+	}
+	if v, ok := opt.CacheControl[strings.ToLower(path.Ext(file))]; ok {
+		return v
+	}
+	return opt.CacheControl["*"]
+}
+
+// fingerprintLen is the length of hash in fingerprinted file names.
+const fingerprintLen = 8
+
+var fingerprintPattern = regexp.MustCompile(`^(.+)\.([0-9a-f]{` + strconv.Itoa(fingerprintLen) + `})(\.[^./]+)$`)
+
+// splitFingerprint returns original path and hash of fingerprinted path, or empty strings if it is not.
+func splitFingerprint(file string) (string, string) {
+	m := fingerprintPattern.FindStringSubmatch(file)
+	if m == nil {
+		return "", ""
+	}
+	return m[1] + m[3], m[2]
+}
+
+// assetStatics are static options with fingerprint enabled.
+var assetStatics struct {
+	lock sync.RWMutex
+	opts []*StaticOptions
+}
+
+func registerAssetStatic(opt *StaticOptions) {
+	assetStatics.lock.Lock()
+	defer assetStatics.lock.Unlock()
+
+	assetStatics.opts = append(assetStatics.opts, opt)
+}
+
+// Asset returns fingerprinted URL of static file, e.g. "/js/app.js" to "/js/app.3f9a1c0b.js".
+// Only static handlers with Fingerprint enabled are searched, and URL is returned as it is if file is not found.
+func Asset(urlPath string) string {
+	name := urlPath
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	ext := path.Ext(name)
+	if len(ext) == 0 {
+		return urlPath
+	}
+
+	assetStatics.lock.RLock()
+	defer assetStatics.lock.RUnlock()
+
+	for _, opt := range assetStatics.opts {
+		file := name
+		if opt.Prefix != "" {
+			if !strings.HasPrefix(file, opt.Prefix+"/") {
+				continue
+			}
+			file = file[len(opt.Prefix):]
+		}
+
+		sum, err := opt.fileSum(file)
+		if err != nil {
+			continue
+		}
+		return opt.Prefix + file[:len(file)-len(ext)] + "." + sum[:fingerprintLen] + ext
+	}
+	return urlPath
+}
+
+// fileSum returns hex encoded SHA-1 of file.
+func (opt *StaticOptions) fileSum(file string) (string, error) {
+	f, err := opt.FileSystem.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if fi.IsDir() {
+		return "", fmt.Errorf("%s is a directory", file)
+	}
+	return opt.sum(file, fi.ModTime(), f)
+}
 
-	http.ServeContent(ctx.Resp, ctx.Req.Request, file, fi.ModTime(), f)
+// isGzipExtension returns true if file should be served compressed.
+func (opt *StaticOptions) isGzipExtension(file string) bool {
+	ext := strings.ToLower(path.Ext(file))
+	for _, e := range opt.GzipExtensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsEncoding returns true if given content coding is acceptable by Accept-Encoding header.
+func acceptsEncoding(header, coding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		name, q := part, ""
+		if i := strings.Index(part, ";"); i >= 0 {
+			name, q = strings.TrimSpace(part[:i]), strings.TrimSpace(part[i+1:])
+		}
+		if !strings.EqualFold(name, coding) {
+			continue
+		}
+		if strings.HasPrefix(q, "q=") {
+			v, err := strconv.ParseFloat(q[2:], 64)
+			return err == nil && v > 0
+		}
+		return true
+	}
+	return false
+}
+
+// serveCompressed serves precompressed sibling of file if present, or compressed content from cache.
+// It returns false if client accepts no available content coding.
+func serveCompressed(ctx *Context, opt StaticOptions, file string, fi os.FileInfo, minify MinifyFunc) bool {
+	accept := ctx.Req.Header.Get(HeaderAcceptEncoding)
+	for _, enc := range []struct{ coding, suffix string }{{"br", ".br"}, {"gzip", ".gz"}} {
+		if !acceptsEncoding(accept, enc.coding) {
+			continue
+		}
+		f, err := opt.FileSystem.Open(file + enc.suffix)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		cfi, err := f.Stat()
+		if err != nil || cfi.IsDir() {
+			continue
+		}
+
+		setEncodingHeaders(ctx, file, enc.coding)
+		opt.serveContent(ctx, file, file+enc.suffix, cfi.ModTime(), cfi.Size(), f)
+		return true
+	}
+
+	if !acceptsEncoding(accept, "gzip") {
+		return false
+	}
+	data, err := opt.cache.get(file+"#gzip", fi.ModTime(), func(data []byte) ([]byte, error) {
+		if minify != nil {
+			if out, err := minify(data); err == nil {
+				data = out
+			}
+		}
+		var buf bytes.Buffer
+		gz, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if _, err := gz.Write(data); err != nil {
+			return nil, err
+		}
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}, func() ([]byte, error) {
+		f, err := opt.FileSystem.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return ioutil.ReadAll(f)
+	})
+	if err != nil {
+		return false
+	}
+
+	setEncodingHeaders(ctx, file, "gzip")
+	opt.serveContent(ctx, file, file+"#gzip", fi.ModTime(), int64(len(data)), bytes.NewReader(data))
 	return true
 }
 
+// setEncodingHeaders sets headers of encoded content, and makes sure it is not encoded again.
+func setEncodingHeaders(ctx *Context, file, coding string) {
+	skipMinify(ctx)
+	skipGzip(ctx)
+
+	header := ctx.Resp.Header()
+	header.Set(HeaderContentEncoding, coding)
+	ctype := mime.TypeByExtension(path.Ext(file))
+	if len(ctype) == 0 {
+		ctype = "application/octet-stream"
+	}
+	header.Set(HeaderContentType, ctype)
+}
+
 // Static returns a middleware handler that serves static files in the given directory.
 func Static(directory string, staticOpt ...StaticOptions) Handler {
 	opt := prepareStaticOptions(directory, staticOpt)
+	if opt.Fingerprint {
+		registerAssetStatic(&opt)
+	}
 
 	return func(ctx *Context, log *Logger) {
 		staticHandler(ctx, log, opt)
@@ -192,6 +605,9 @@ func Statics(opt StaticOptions, dirs ...string) Handler {
 	opts := make([]StaticOptions, len(dirs))
 	for i := range dirs {
 		opts[i] = prepareStaticOption(dirs[i], opt)
+		if opts[i].Fingerprint {
+			registerAssetStatic(&opts[i])
+		}
 	}
 
 	return func(ctx *Context, log *Logger) {
@@ -0,0 +1,202 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package bigo
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fym201/bigo/utl"
+)
+
+// DirEntry represents a file in directory listing.
+type DirEntry struct {
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	IsDir     bool      `json:"dir"`
+	Size      int64     `json:"size"`
+	HumanSize string    `json:"-"`
+	ModTime   time.Time `json:"mtime"`
+}
+
+// DirListing is the data to render directory listing.
+type DirListing struct {
+	// URL path of directory.
+	Path string `json:"path"`
+	// Whether directory has parent in static handler.
+	HasParent bool `json:"-"`
+	// Field to sort by, one of "name", "size" and "mtime".
+	Sort string `json:"sort"`
+	// Order to sort by, "asc" or "desc".
+	Order   string     `json:"order"`
+	Entries []DirEntry `json:"entries"`
+}
+
+// SortLink returns query string to sort by given field, order is reversed if it is sorted by the field already.
+func (l *DirListing) SortLink(field string) string {
+	order := "asc"
+	if l.Sort == field && l.Order == "asc" {
+		order = "desc"
+	}
+	return "?sort=" + field + "&order=" + order
+}
+
+// DefaultListingTemplate is the template to render directory listing in HTML, the data is *DirListing.
+var DefaultListingTemplate = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Index of {{.Path}}</title>
+</head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<thead><tr><th><a href="{{.SortLink "name"}}">Name</a></th><th><a href="{{.SortLink "size"}}">Size</a></th><th><a href="{{.SortLink "mtime"}}">Modified</a></th></tr></thead>
+<tbody>
+{{if .HasParent}}<tr><td><a href="../">../</a></td><td>-</td><td></td></tr>
+{{end}}{{range .Entries}}<tr><td><a href="{{.URL}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td><td>{{if .IsDir}}-{{else}}{{.HumanSize}}{{end}}</td><td>{{.ModTime.Format "2006-01-02 15:04:05"}}</td></tr>
+{{end}}</tbody>
+</table>
+</body>
+</html>
+`))
+
+// wantsJSON returns true if client asks for directory listing in JSON.
+func wantsJSON(ctx *Context) bool {
+	return ctx.Query("format") == "json" || strings.Contains(ctx.Req.Header.Get("Accept"), "application/json")
+}
+
+// sortDirEntries sorts entries by field and order, directories always come first.
+func sortDirEntries(entries []DirEntry, field, order string) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		if order == "desc" {
+			a, b = b, a
+		}
+		switch field {
+		case "size":
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+		case "mtime":
+			if !a.ModTime.Equal(b.ModTime) {
+				return a.ModTime.Before(b.ModTime)
+			}
+		}
+		return a.Name < b.Name
+	})
+}
+
+// serveListing renders listing of directory in HTML or JSON,
+// directories under any path segment start with "." are not found unless ShowHidden is set.
+func serveListing(ctx *Context, log *Logger, opt StaticOptions, file string, dir http.File) {
+	if !opt.ShowHidden && isHiddenPath(file) {
+		http.NotFound(ctx.Resp, ctx.Req.Request)
+		return
+	}
+
+	fis, err := dir.Readdir(-1)
+	if err != nil {
+		log.Error("static: fail to read directory", "path", file, "error", err)
+		http.Error(ctx.Resp, "500 internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	l := &DirListing{
+		Path:      ctx.Req.URL.Path,
+		HasParent: strings.Trim(file, "/") != "",
+		Sort:      ctx.Query("sort"),
+		Order:     ctx.Query("order"),
+		Entries:   make([]DirEntry, 0, len(fis)),
+	}
+	if l.Sort != "size" && l.Sort != "mtime" {
+		l.Sort = "name"
+	}
+	if l.Order != "desc" {
+		l.Order = "asc"
+	}
+
+	for _, fi := range fis {
+		name := fi.Name()
+		if !opt.ShowHidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+		e := DirEntry{
+			Name:    name,
+			URL:     (&url.URL{Path: name}).String(),
+			IsDir:   fi.IsDir(),
+			ModTime: fi.ModTime(),
+		}
+		if e.IsDir {
+			e.URL += "/"
+		} else {
+			e.Size = fi.Size()
+			e.HumanSize = utl.HumaneFileSize(uint64(e.Size))
+		}
+		l.Entries = append(l.Entries, e)
+	}
+	sortDirEntries(l.Entries, l.Sort, l.Order)
+
+	if !opt.SkipLogging {
+		log.LogInfo("[Static] Listing " + file)
+	}
+
+	header := ctx.Resp.Header()
+	header.Add(HeaderVary, "Accept")
+	if wantsJSON(ctx) {
+		data, err := json.Marshal(l)
+		if err != nil {
+			http.Error(ctx.Resp, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		header.Set(HeaderContentType, ContentJSON+"; charset=UTF-8")
+		ctx.Resp.WriteHeader(http.StatusOK)
+		ctx.Resp.Write(data)
+		return
+	}
+
+	t := opt.ListingTemplate
+	if t == nil {
+		t = DefaultListingTemplate
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, l); err != nil {
+		log.Error("static: fail to render directory listing", "path", file, "error", err)
+		http.Error(ctx.Resp, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	header.Set(HeaderContentType, ContentHTML+"; charset=UTF-8")
+	ctx.Resp.WriteHeader(http.StatusOK)
+	ctx.Resp.Write(buf.Bytes())
+}
+
+// isHiddenPath returns true if any segment of given path starts with ".".
+func isHiddenPath(file string) bool {
+	for _, seg := range strings.Split(file, "/") {
+		if strings.HasPrefix(seg, ".") {
+			return true
+		}
+	}
+	return false
+}
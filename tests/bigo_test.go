@@ -16,6 +16,7 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -159,3 +160,106 @@ func Test_Bigo_EarlyWrite(t *testing.T) {
 		So(resp.Code, ShouldEqual, http.StatusOK)
 	})
 }
+
+func Test_Bigo_Shutdown(t *testing.T) {
+	Convey("Shutdown running server gracefully", t, func() {
+		result := ""
+		m := New()
+		m.OnStart(func() {
+			result += "start"
+		})
+		m.OnShutdown(func() {
+			result += "db"
+		})
+		m.OnShutdown(func() {
+			result += "hub"
+		})
+		m.Get("/", func() string {
+			return "Hello world"
+		})
+
+		stopped := make(chan bool)
+		go func() {
+			m.RunHttp("127.0.0.1:4010")
+			stopped <- true
+		}()
+		time.Sleep(100 * time.Millisecond)
+
+		resp, err := http.Get("http://127.0.0.1:4010/")
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		So(m.IsShuttingDown(), ShouldBeFalse)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		So(m.Shutdown(ctx), ShouldBeNil)
+		So(<-stopped, ShouldBeTrue)
+		So(m.IsShuttingDown(), ShouldBeTrue)
+		So(result, ShouldEqual, "starthubdb")
+
+		_, err = http.Get("http://127.0.0.1:4010/")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Fail readiness check while draining on shutdown", t, func() {
+		m := New()
+		m.Use(Health(HealthOptions{Registry: NewHealthRegistry()}))
+		m.SetReadinessDrain(300 * time.Millisecond)
+		m.Get("/", func() string {
+			return "Hello world"
+		})
+
+		stopped := make(chan bool)
+		go func() {
+			m.RunHttp("127.0.0.1:4011")
+			stopped <- true
+		}()
+		time.Sleep(100 * time.Millisecond)
+
+		get := func(path string) int {
+			resp, err := http.Get("http://127.0.0.1:4011" + path)
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+		So(get("/readyz"), ShouldEqual, http.StatusOK)
+
+		done := make(chan error)
+		go func() {
+			done <- m.Shutdown(context.Background())
+		}()
+		time.Sleep(100 * time.Millisecond)
+		So(get("/readyz"), ShouldEqual, http.StatusServiceUnavailable)
+		So(get("/"), ShouldEqual, http.StatusOK)
+
+		So(<-done, ShouldBeNil)
+		So(<-stopped, ShouldBeTrue)
+		_, err := http.Get("http://127.0.0.1:4011/")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Shutdown completes when a hook panics", t, func() {
+		result := ""
+		m := New()
+		m.OnShutdown(func() {
+			result += "db"
+		})
+		m.OnShutdown(func() {
+			panic("hub is gone")
+		})
+
+		So(m.Shutdown(context.Background()), ShouldNotBeNil)
+		So(result, ShouldEqual, "db")
+
+		done := make(chan error)
+		go func() {
+			done <- m.Shutdown(context.Background())
+		}()
+		select {
+		case err := <-done:
+			So(err, ShouldNotBeNil)
+		case <-time.After(time.Second):
+			t.Fatal("second Shutdown blocked")
+		}
+	})
+}
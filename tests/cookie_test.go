@@ -0,0 +1,171 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/fym201/bigo"
+
+	"github.com/fym201/bigo/utl"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_CookieCodec(t *testing.T) {
+	Convey("Encode and decode cookie value", t, func() {
+		codec := NewCookieCodec("secret")
+		val, err := codec.Encode("user", "Unknwon")
+		So(err, ShouldBeNil)
+
+		text, err := codec.Decode("user", val)
+		So(err, ShouldBeNil)
+		So(text, ShouldEqual, "Unknwon")
+
+		Convey("Value is bound to cookie name", func() {
+			_, err := codec.Decode("admin", val)
+			So(err, ShouldEqual, ErrInvalidCookie)
+		})
+
+		Convey("Tampered value is rejected", func() {
+			b := []byte(val)
+			b[len(b)-2] ^= 1
+			_, err := codec.Decode("user", string(b))
+			So(err, ShouldEqual, ErrInvalidCookie)
+		})
+
+		Convey("Rotate secrets", func() {
+			text, err := NewCookieCodec("new-secret", "secret").Decode("user", val)
+			So(err, ShouldBeNil)
+			So(text, ShouldEqual, "Unknwon")
+
+			_, err = NewCookieCodec("new-secret").Decode("user", val)
+			So(err, ShouldEqual, ErrInvalidCookie)
+		})
+
+		Convey("Expired value is rejected", func() {
+			codec.MaxAge = 60
+			codec.Now = func() time.Time {
+				return time.Now().Add(61 * time.Second)
+			}
+			_, err := codec.Decode("user", val)
+			So(err, ShouldEqual, ErrExpiredCookie)
+		})
+	})
+
+	Convey("Decode legacy cookie value", t, func() {
+		m := md5.Sum([]byte("secret"))
+		b, err := utl.AESEncrypt([]byte(hex.EncodeToString(m[:])), []byte("Unknwon"))
+		So(err, ShouldBeNil)
+		legacy := hex.EncodeToString(b)
+
+		codec := NewCookieCodec("secret")
+		_, err = codec.Decode("user", legacy)
+		So(err, ShouldEqual, ErrInvalidCookie)
+
+		codec.AllowLegacy = true
+		text, err := codec.Decode("user", legacy)
+		So(err, ShouldBeNil)
+		So(text, ShouldEqual, "Unknwon")
+	})
+
+	Convey("Set and get secure cookie with rotated secrets", t, func() {
+		m := New()
+		m.SetDefaultCookieSecret("old-secret")
+		m.Get("/set", func(ctx *Context) {
+			ctx.SetSecureCookie("user", "Unknwon", 1)
+		})
+		m.Get("/get", func(ctx *Context) string {
+			val, ok := ctx.GetSecureCookie("user")
+			So(ok, ShouldBeTrue)
+			return val
+		})
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/set", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+		cookie := resp.Header().Get("Set-Cookie")
+
+		m.SetDefaultCookieSecret("new-secret", "old-secret")
+		resp = httptest.NewRecorder()
+		req, err = http.NewRequest("GET", "/get", nil)
+		So(err, ShouldBeNil)
+		req.Header.Set("Cookie", cookie)
+		m.ServeHTTP(resp, req)
+		So(resp.Body.String(), ShouldEqual, "Unknwon")
+	})
+
+	Convey("Get legacy super secure cookie", t, func() {
+		sum := md5.Sum([]byte("super-secret"))
+		b, err := utl.AESEncrypt([]byte(hex.EncodeToString(sum[:])), []byte("Unknwon"))
+		So(err, ShouldBeNil)
+		legacy := hex.EncodeToString(b)
+
+		get := func(allowLegacy bool) string {
+			m := New()
+			codec := NewCookieCodec("secret")
+			codec.AllowLegacy = allowLegacy
+			m.SetCookieCodec(codec)
+			m.Get("/", func(ctx *Context) string {
+				val, _ := ctx.GetSuperSecureCookie("super-secret", "user")
+				return val
+			})
+
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", "/", nil)
+			So(err, ShouldBeNil)
+			req.AddCookie(&http.Cookie{Name: "user", Value: legacy})
+			m.ServeHTTP(resp, req)
+			return resp.Body.String()
+		}
+		So(get(false), ShouldBeEmpty)
+		So(get(true), ShouldEqual, "Unknwon")
+		So(get(false), ShouldBeEmpty)
+	})
+
+	Convey("Set and get cookie with given codec", t, func() {
+		codec := NewCookieCodec("codec-secret")
+		m := New()
+		m.Get("/set", func(ctx *Context) {
+			ctx.SetCodecCookie(codec, "user", "Unknwon")
+		})
+		m.Get("/get", func(ctx *Context) string {
+			val, ok := ctx.GetCodecCookie(codec, "user")
+			So(ok, ShouldBeTrue)
+			_, ok = ctx.GetSuperSecureCookie("other-secret", "user")
+			So(ok, ShouldBeFalse)
+			return val
+		})
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/set", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+		cookie := resp.Header().Get("Set-Cookie")
+
+		resp = httptest.NewRecorder()
+		req, err = http.NewRequest("GET", "/get", nil)
+		So(err, ShouldBeNil)
+		req.Header.Set("Cookie", cookie)
+		m.ServeHTTP(resp, req)
+		So(resp.Body.String(), ShouldEqual, "Unknwon")
+	})
+}
@@ -0,0 +1,88 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/fym201/bigo"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_CORS(t *testing.T) {
+	Convey("Handle cross-origin requests", t, func() {
+		m := New()
+		m.Use(CORS(CORSOptions{
+			AllowOrigins:     []string{"https://example.com", "*.bigo.io"},
+			AllowOriginFunc:  func(origin string) bool { return origin == "http://localhost:3000" },
+			AllowCredentials: true,
+			ExposeHeaders:    []string{"X-Total"},
+			MaxAge:           600,
+		}))
+		m.Get("/user/:id", func() string { return "get" })
+		m.Put("/user/:id", func() string { return "put" })
+
+		do := func(method, origin string, header map[string]string) *httptest.ResponseRecorder {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest(method, "/user/1", nil)
+			So(err, ShouldBeNil)
+			req.Header.Set("Origin", origin)
+			for k, v := range header {
+				req.Header.Set(k, v)
+			}
+			m.ServeHTTP(resp, req)
+			return resp
+		}
+
+		Convey("Answer preflight request with registered methods", func() {
+			resp := do("OPTIONS", "https://api.bigo.io", map[string]string{
+				"Access-Control-Request-Method":  "PUT",
+				"Access-Control-Request-Headers": "X-Token",
+			})
+			So(resp.Code, ShouldEqual, http.StatusNoContent)
+			So(resp.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "https://api.bigo.io")
+			So(resp.Header().Get("Access-Control-Allow-Methods"), ShouldEqual, "GET, PUT")
+			So(resp.Header().Get("Access-Control-Allow-Headers"), ShouldEqual, "X-Token")
+			So(resp.Header().Get("Access-Control-Allow-Credentials"), ShouldEqual, "true")
+			So(resp.Header().Get("Access-Control-Max-Age"), ShouldEqual, "600")
+
+			resp = do("OPTIONS", "https://example.com", map[string]string{"Access-Control-Request-Method": "DELETE"})
+			So(resp.Header().Get("Access-Control-Allow-Origin"), ShouldBeEmpty)
+		})
+
+		Convey("Add headers to actual request", func() {
+			resp := do("GET", "http://localhost:3000", nil)
+			So(resp.Body.String(), ShouldEqual, "get")
+			So(resp.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "http://localhost:3000")
+			So(resp.Header().Get("Access-Control-Expose-Headers"), ShouldEqual, "X-Total")
+
+			resp = do("GET", "https://evil.com", nil)
+			So(resp.Body.String(), ShouldEqual, "get")
+			So(resp.Header().Get("Access-Control-Allow-Origin"), ShouldBeEmpty)
+		})
+
+		Convey("Answer OPTIONS request without CORS headers", func() {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("OPTIONS", "/user/1", nil)
+			So(err, ShouldBeNil)
+			m.ServeHTTP(resp, req)
+			So(resp.Code, ShouldEqual, http.StatusNoContent)
+			So(resp.Header().Get("Allow"), ShouldEqual, "GET, HEAD, OPTIONS, PUT")
+		})
+	})
+}
@@ -0,0 +1,118 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	. "github.com/fym201/bigo"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_CSRF(t *testing.T) {
+	Convey("Protect unsafe requests with CSRF token", t, func() {
+		m := New()
+		m.Use(Sessioner())
+		m.Use(CSRF(CSRFOptions{CheckOrigin: true, ExemptGroups: []string{"/api"}}))
+		m.Use(Renderer(RenderOptions{Directory: "fixtures/basic"}))
+		m.Get("/", func(ctx *Context) string {
+			return ctx.Data["CsrfToken"].(string)
+		})
+		m.Get("/form", func(ctx *Context) {
+			ctx.Resp.Header().Set("X-CSRFToken", ctx.Data["CsrfToken"].(string))
+			ctx.HTML(200, "csrf")
+		})
+		m.Post("/", func() string {
+			return "ok"
+		})
+		m.Group("/api", func() {
+			m.Post("/hook", func() string {
+				return "hook"
+			})
+		})
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+		token := resp.Body.String()
+		So(token, ShouldNotBeEmpty)
+		cookie := strings.Split(resp.Header().Get("Set-Cookie"), ";")[0]
+
+		do := func(method, path string, body string, header map[string]string) *httptest.ResponseRecorder {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest(method, path, strings.NewReader(body))
+			So(err, ShouldBeNil)
+			req.Header.Set("Cookie", cookie)
+			if len(body) > 0 {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			for k, v := range header {
+				req.Header.Set(k, v)
+			}
+			m.ServeHTTP(resp, req)
+			return resp
+		}
+
+		Convey("Render token field in template", func() {
+			resp := do("GET", "/form", "", nil)
+			So(resp.Body.String(), ShouldEqual, `<form method="post"><input type="hidden" name="_csrf" value="`+token+`"></form>`)
+		})
+
+		Convey("Render token of own session concurrently", func() {
+			results := make(chan *httptest.ResponseRecorder)
+			for i := 0; i < 100; i++ {
+				go func() {
+					resp := httptest.NewRecorder()
+					req, _ := http.NewRequest("GET", "/form", nil)
+					m.ServeHTTP(resp, req)
+					results <- resp
+				}()
+			}
+			for i := 0; i < 100; i++ {
+				resp := <-results
+				So(resp.Body.String(), ShouldContainSubstring, `value="`+resp.Header().Get("X-CSRFToken")+`"`)
+			}
+		})
+
+		Convey("Reject request without token", func() {
+			resp := do("POST", "/", "", nil)
+			So(resp.Code, ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("Accept token from header or form", func() {
+			resp := do("POST", "/", "", map[string]string{"X-CSRFToken": token})
+			So(resp.Body.String(), ShouldEqual, "ok")
+
+			resp = do("POST", "/", url.Values{"_csrf": {token}}.Encode(), nil)
+			So(resp.Body.String(), ShouldEqual, "ok")
+		})
+
+		Convey("Reject request from other origin", func() {
+			resp := do("POST", "/", "", map[string]string{"X-CSRFToken": token, "Origin": "http://evil.com"})
+			So(resp.Code, ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("Skip exempt groups", func() {
+			resp := do("POST", "/api/hook", "", nil)
+			So(resp.Body.String(), ShouldEqual, "hook")
+		})
+	})
+}
@@ -0,0 +1,115 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/fym201/bigo"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_Debug(t *testing.T) {
+	Convey("Mount debug routes guarded by basic auth", t, func() {
+		m := New()
+		m.Get("/users/:id", func() {}, func() {})
+		m.Debug(DebugOptions{Prefix: "/_debug/", User: "admin", Password: "secret"})
+		get := func(url string, auth bool) *httptest.ResponseRecorder {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", url, nil)
+			So(err, ShouldBeNil)
+			if auth {
+				req.SetBasicAuth("admin", "secret")
+			}
+			m.ServeHTTP(resp, req)
+			return resp
+		}
+
+		resp := get("/_debug/routes", false)
+		So(resp.Code, ShouldEqual, http.StatusUnauthorized)
+		So(resp.Header().Get("WWW-Authenticate"), ShouldContainSubstring, "Basic")
+
+		resp = get("/_debug/routes", true)
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		var data struct {
+			Routes []RouteInfo `json:"routes"`
+		}
+		So(json.Unmarshal(resp.Body.Bytes(), &data), ShouldBeNil)
+		So(data.Routes, ShouldContain, RouteInfo{"GET", "/users/:id", 2})
+		So(data.Routes, ShouldContain, RouteInfo{"GET", "/_debug/vars", 2})
+
+		resp = get("/_debug/pprof/", true)
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(resp.Body.String(), ShouldContainSubstring, "goroutine")
+
+		resp = get("/_debug/pprof/goroutine?debug=1", true)
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(resp.Body.String(), ShouldContainSubstring, "goroutine profile")
+
+		resp = get("/_debug/pprof/nothing", true)
+		So(resp.Code, ShouldEqual, http.StatusNotFound)
+
+		resp = get("/_debug/vars", true)
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(resp.Body.String(), ShouldContainSubstring, `"memstats"`)
+
+		resp = get("/_debug/goroutines", true)
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(strings.HasPrefix(resp.Body.String(), "goroutine "), ShouldBeTrue)
+	})
+
+	Convey("Allow only loopback requests without auth", t, func() {
+		m := New()
+		m.Debug()
+		get := func(remoteAddr string, header map[string]string) int {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", "/debug/routes", nil)
+			So(err, ShouldBeNil)
+			req.RemoteAddr = remoteAddr
+			for k, v := range header {
+				req.Header.Set(k, v)
+			}
+			m.ServeHTTP(resp, req)
+			return resp.Code
+		}
+
+		So(get("127.0.0.1:4000", nil), ShouldEqual, http.StatusOK)
+		So(get("[::1]:4000", nil), ShouldEqual, http.StatusOK)
+		So(get("10.0.0.1:4000", nil), ShouldEqual, http.StatusForbidden)
+		So(get("", nil), ShouldEqual, http.StatusForbidden)
+		So(get("127.0.0.1:4000", map[string]string{"X-Forwarded-For": "10.0.0.1"}), ShouldEqual, http.StatusForbidden)
+	})
+
+	Convey("Disable debug routes in production mode", t, func() {
+		SetEnv(Prod)
+		defer SetEnv(Dev)
+
+		m := New()
+		m.Debug()
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/debug/routes", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+		So(resp.Code, ShouldEqual, http.StatusNotFound)
+
+		So(func() { m.Debug(DebugOptions{Enable: true}) }, ShouldPanic)
+	})
+}
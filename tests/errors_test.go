@@ -0,0 +1,113 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/fym201/bigo"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_ErrorHandler(t *testing.T) {
+	Convey("Respond errors by registered handlers", t, func() {
+		dir, err := ioutil.TempDir("", "bigo-tmpl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		So(ioutil.WriteFile(filepath.Join(dir, "error.tmpl"),
+			[]byte(`{{.Status}} {{.Error}} {{.RequestID}}`), 0644), ShouldBeNil)
+
+		m := New()
+		m.Use(Recovery())
+		m.Use(Renderer(RenderOptions{Directory: dir}))
+		m.ErrorHandler(0, ErrorHTML("error"))
+		m.ErrorHandler(http.StatusForbidden, ErrorJSON())
+		m.Get("/forbidden", func(ctx *Context) {
+			ctx.HandleError(http.StatusForbidden, NewHTTPError(http.StatusForbidden, "no access"))
+		})
+		m.Get("/render", func(ctx *Context) {
+			ctx.Error(http.StatusTeapot, "short and stout")
+		})
+		m.Get("/returned", func() error {
+			return NewHTTPError(http.StatusConflict, "already exists")
+		})
+		m.Get("/internal", func() error {
+			return errors.New("database is down")
+		})
+		m.Get("/panic", func() {
+			panic("here is a panic!")
+		})
+		get := func(url string) *httptest.ResponseRecorder {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", url, nil)
+			So(err, ShouldBeNil)
+			req.Header.Set("X-Request-Id", "abc")
+			m.ServeHTTP(resp, req)
+			return resp
+		}
+
+		resp := get("/forbidden")
+		So(resp.Code, ShouldEqual, http.StatusForbidden)
+		So(resp.Body.String(), ShouldEqual, `{"error":"no access","request_id":"abc","status":403}`)
+
+		resp = get("/render")
+		So(resp.Code, ShouldEqual, http.StatusTeapot)
+		So(resp.Body.String(), ShouldEqual, "418 short and stout abc")
+
+		resp = get("/returned")
+		So(resp.Code, ShouldEqual, http.StatusConflict)
+		So(resp.Body.String(), ShouldEqual, "409 already exists abc")
+
+		resp = get("/internal")
+		So(resp.Code, ShouldEqual, http.StatusInternalServerError)
+		So(resp.Body.String(), ShouldEqual, "500 Internal Server Error abc")
+
+		resp = get("/panic")
+		So(resp.Code, ShouldEqual, http.StatusInternalServerError)
+		So(resp.Body.String(), ShouldEqual, "500 Internal Server Error abc")
+
+		resp = get("/nowhere")
+		So(resp.Code, ShouldEqual, http.StatusNotFound)
+		So(resp.Body.String(), ShouldEqual, "404 Not Found abc")
+	})
+
+	Convey("Respond errors in plain text without handlers", t, func() {
+		m := New()
+		m.Get("/forbidden", func(ctx *Context) {
+			ctx.HandleError(http.StatusForbidden, nil)
+		})
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/forbidden", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+		So(resp.Code, ShouldEqual, http.StatusForbidden)
+		So(resp.Body.String(), ShouldEqual, "Forbidden\n")
+
+		resp = httptest.NewRecorder()
+		req, err = http.NewRequest("GET", "/nowhere", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+		So(resp.Code, ShouldEqual, http.StatusNotFound)
+		So(resp.Body.String(), ShouldEqual, "404 page not found\n")
+	})
+}
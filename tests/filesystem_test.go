@@ -0,0 +1,116 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	. "github.com/fym201/bigo"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_FileSystem(t *testing.T) {
+	Convey("Serve statics and templates from zip archive", t, func() {
+		buf := new(bytes.Buffer)
+		zw := zip.NewWriter(buf)
+		for name, content := range map[string]string{
+			"public/app.css":     "body{}",
+			"public/index.html":  "<p>index</p>",
+			"views/hello.tmpl":   "<h1>Hello {{.}}</h1>",
+			"views/admin/x.tmpl": "admin",
+		} {
+			w, err := zw.Create(name)
+			So(err, ShouldBeNil)
+			w.Write([]byte(content))
+		}
+		So(zw.Close(), ShouldBeNil)
+
+		dir, err := ioutil.TempDir("", "bigo-fs")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		name := filepath.Join(dir, "assets.zip")
+		So(ioutil.WriteFile(name, buf.Bytes(), 0644), ShouldBeNil)
+
+		fsys, err := GetFileSystem("zip:" + name)
+		So(err, ShouldBeNil)
+
+		m := New()
+		m.Use(Static("", StaticOptions{Prefix: "static", SkipLogging: true, ETag: true, FileSystem: StaticFS(fsys, "public")}))
+		m.Use(Renderer(RenderOptions{Directory: "views", FileSystem: fsys}))
+		m.Get("/hello", func(r Render) {
+			r.HTML(200, "hello", "zip")
+		})
+		m.Get("/admin", func(r Render) {
+			r.HTML(200, "admin/x", nil)
+		})
+
+		get := func(url, rng string) *httptest.ResponseRecorder {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", url, nil)
+			So(err, ShouldBeNil)
+			if len(rng) > 0 {
+				req.Header.Set("Range", rng)
+			}
+			m.ServeHTTP(resp, req)
+			return resp
+		}
+
+		resp := get("/static/app.css", "")
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(resp.Body.String(), ShouldEqual, "body{}")
+		So(resp.Header().Get("Content-Type"), ShouldContainSubstring, "text/css")
+		So(resp.Header().Get("ETag"), ShouldNotBeBlank)
+
+		resp = get("/static/app.css", "bytes=0-3")
+		So(resp.Code, ShouldEqual, http.StatusPartialContent)
+		So(resp.Body.String(), ShouldEqual, "body")
+
+		So(get("/static/", "").Body.String(), ShouldEqual, "<p>index</p>")
+		So(get("/static", "").Code, ShouldEqual, http.StatusFound)
+		So(get("/static/missing.css", "").Code, ShouldEqual, http.StatusNotFound)
+
+		So(get("/hello", "").Body.String(), ShouldEqual, "<h1>Hello zip</h1>")
+		So(get("/admin", "").Body.String(), ShouldEqual, "admin")
+	})
+
+	Convey("Serve statics from registered io/fs file system", t, func() {
+		RegisterFileSystem("memory", fstest.MapFS{
+			"app.js": &fstest.MapFile{Data: []byte("var a;")},
+		})
+		fsys, err := GetFileSystem("memory")
+		So(err, ShouldBeNil)
+		_, err = GetFileSystem("missing")
+		So(err, ShouldNotBeNil)
+
+		m := New()
+		m.Use(Static("", StaticOptions{SkipLogging: true, FileSystem: StaticFS(fsys, "")}))
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/app.js", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(resp.Body.String(), ShouldEqual, "var a;")
+	})
+}
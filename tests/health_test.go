@@ -0,0 +1,98 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/fym201/bigo"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_Health(t *testing.T) {
+	Convey("Serve liveness and readiness with checks", t, func() {
+		registry := NewHealthRegistry()
+		registry.RegisterLiveness("memory", 0, func(context.Context) error {
+			return nil
+		})
+		registry.Register("database", 0, func(context.Context) error {
+			return errors.New("connection refused")
+		})
+		registry.Register("cache", 10*time.Millisecond, func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})
+
+		m := New()
+		m.Use(Health(HealthOptions{Registry: registry}))
+		get := func(url string) (int, HealthReport) {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", url, nil)
+			So(err, ShouldBeNil)
+			m.ServeHTTP(resp, req)
+			So(resp.Header().Get("Content-Type"), ShouldEqual, "application/json; charset=UTF-8")
+			var report HealthReport
+			So(json.Unmarshal(resp.Body.Bytes(), &report), ShouldBeNil)
+			return resp.Code, report
+		}
+
+		code, report := get("/healthz")
+		So(code, ShouldEqual, http.StatusOK)
+		So(report.Status, ShouldEqual, "ok")
+		So(len(report.Checks), ShouldEqual, 1)
+		So(report.Checks[0].Name, ShouldEqual, "memory")
+
+		code, report = get("/readyz")
+		So(code, ShouldEqual, http.StatusServiceUnavailable)
+		So(report.Status, ShouldEqual, "fail")
+		So(len(report.Checks), ShouldEqual, 3)
+		So(report.Checks[1].Name, ShouldEqual, "database")
+		So(report.Checks[1].Error, ShouldEqual, "connection refused")
+		So(report.Checks[2].Status, ShouldEqual, "timeout")
+
+		registry.Unregister("database")
+		registry.Unregister("cache")
+		code, _ = get("/readyz")
+		So(code, ShouldEqual, http.StatusOK)
+
+		So(m.Shutdown(context.Background()), ShouldBeNil)
+		code, report = get("/readyz")
+		So(code, ShouldEqual, http.StatusServiceUnavailable)
+		So(report.Checks[len(report.Checks)-1].Name, ShouldEqual, "shutdown")
+	})
+
+	Convey("Check template sets of Renderer", t, func() {
+		m := New()
+		m.Use(Health())
+		m.Use(Renderer(RenderOptions{Directory: "fixtures/basic"}))
+		m.Use(Renderer(RenderOptions{Directory: "fixtures/basic2"}))
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/readyz", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(resp.Body.String(), ShouldContainSubstring, `"name":"templates:fixtures/basic","status":"ok"`)
+		So(resp.Body.String(), ShouldContainSubstring, `"name":"templates:fixtures/basic2","status":"ok"`)
+	})
+}
@@ -0,0 +1,89 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/fym201/bigo"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_Metrics(t *testing.T) {
+	Convey("Record and expose request metrics", t, func() {
+		registry := NewMetricsRegistry()
+		m := New()
+		m.Use(Metrics(MetricsOptions{Registry: registry, Namespace: "test"}))
+		m.Get("/users/:id", func() string {
+			return "user"
+		})
+		m.Get("/fail", func(ctx *Context) {
+			ctx.Resp.WriteHeader(http.StatusServiceUnavailable)
+		})
+		get := func(url string) *httptest.ResponseRecorder {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", url, nil)
+			So(err, ShouldBeNil)
+			m.ServeHTTP(resp, req)
+			return resp
+		}
+		get("/users/1")
+		get("/users/2")
+		get("/fail")
+		get("/nowhere")
+
+		resp := get("/metrics")
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(resp.Header().Get("Content-Type"), ShouldEqual, ContentMetrics)
+		body := resp.Body.String()
+		So(body, ShouldContainSubstring, "# TYPE test_http_requests_total counter\n")
+		So(body, ShouldContainSubstring, `test_http_requests_total{method="GET",route="/users/:id",status="2xx"} 2`+"\n")
+		So(body, ShouldContainSubstring, `test_http_requests_total{method="GET",route="/fail",status="5xx"} 1`+"\n")
+		So(body, ShouldContainSubstring, `test_http_requests_total{method="GET",route="unmatched",status="4xx"} 1`+"\n")
+		So(body, ShouldContainSubstring, `test_http_request_duration_seconds_bucket{method="GET",route="/users/:id",status="2xx",le="+Inf"} 2`+"\n")
+		So(body, ShouldContainSubstring, `test_http_response_size_bytes_bucket{method="GET",route="/users/:id",status="2xx",le="100"} 2`+"\n")
+		So(body, ShouldContainSubstring, `test_http_response_size_bytes_sum{method="GET",route="/users/:id",status="2xx"} 8`+"\n")
+		So(body, ShouldContainSubstring, "test_http_requests_in_flight 0\n")
+		So(body, ShouldNotContainSubstring, `route="/metrics"`)
+	})
+
+	Convey("Write metrics in text exposition format", t, func() {
+		registry := NewMetricsRegistry()
+		registry.Gauge("queue_size", "Size of \"queue\".", "name").Set(3, `a"b`)
+		h := registry.Histogram("job_seconds", "Duration of jobs.", []float64{1, 0.5})
+		h.Observe(0.5)
+		h.Observe(2)
+
+		var buf bytes.Buffer
+		_, err := registry.WriteTo(&buf)
+		So(err, ShouldBeNil)
+		So(buf.String(), ShouldEqual, `# HELP job_seconds Duration of jobs.
+# TYPE job_seconds histogram
+job_seconds_bucket{le="0.5"} 1
+job_seconds_bucket{le="1"} 1
+job_seconds_bucket{le="+Inf"} 2
+job_seconds_sum 2.5
+job_seconds_count 2
+# HELP queue_size Size of "queue".
+# TYPE queue_size gauge
+queue_size{name="a\"b"} 3
+`)
+		So(func() { registry.Counter("queue_size", "") }, ShouldPanic)
+	})
+}
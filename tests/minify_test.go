@@ -0,0 +1,132 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/fym201/bigo"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_Minifier(t *testing.T) {
+	Convey("Minify built-in content types", t, func() {
+		out, err := MinifyHTML([]byte("<div>\n  <!-- note -->\n  <p>a   b</p>\n  <pre>  x\n  y</pre>\n</div>\n"))
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, "<div> <p>a b</p> <pre>  x\n  y</pre> </div>")
+
+		out, err = MinifyCSS([]byte("/* c */\nbody {\n  color: red;\n  content: \"a  b\";\n}\n"))
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, `body{color: red;content: "a  b"}`)
+
+		out, err = MinifyJSON([]byte("{\n  \"a\": [1, 2]\n}"))
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, `{"a":[1,2]}`)
+	})
+
+	Convey("Minify JavaScript conservatively", t, func() {
+		for src, expect := range map[string]string{
+			"// c\nvar a = 1;  \n\n  /* b\n */\nvar b = 2; // d\n": "var a = 1;\nvar b = 2;",
+			"/*! license */\nvar a = 1 /* b */ + 2;":               "/*! license */\nvar a = 1 + 2;",
+			"var s = 'a // b', t = \"/* c */\";":                   "var s = 'a // b', t = \"/* c */\";",
+			"var s = 'a \\\n  b';\n  // c":                         "var s = 'a \\\n  b';",
+			"var s = `x\n  // y ${ {a: `\n  /* z */`}.a }\n  w`;":  "var s = `x\n  // y ${ {a: `\n  /* z */`}.a }\n  w`;",
+			"var r = /\\/\\/[/*]/g, d = a / 2 / b;\nreturn /a//b/": "var r = /\\/\\/[/*]/g, d = a / 2 / b;\nreturn /a//b/",
+			"if (a) {\n  x = typeof /\\/\\//\n}":                   "if (a) {\nx = typeof /\\/\\//\n}",
+		} {
+			out, err := MinifyJS([]byte(src))
+			So(err, ShouldBeNil)
+			So(string(out), ShouldEqual, expect)
+		}
+	})
+
+	Convey("Minify responses and opt out routes", t, func() {
+		m := New()
+		m.Use(Minifier())
+		m.Get("/", func(ctx *Context) {
+			ctx.Resp.Header().Set("Content-Type", "text/html")
+			ctx.Resp.WriteHeader(http.StatusCreated)
+			ctx.Resp.Write([]byte("<p>\n  hi\n</p>"))
+		})
+		m.Get("/raw", NoMinify(), func() string { return "<p>\n  hi\n</p>" })
+		m.Get("/text", func(ctx *Context) {
+			ctx.Resp.Header().Set("Content-Type", "text/plain")
+			ctx.Resp.Write([]byte("a   b"))
+		})
+		m.Get("/js", func(ctx *Context) {
+			ctx.Resp.Header().Set("Content-Type", "application/javascript")
+			ctx.Resp.Write([]byte("var s = 'a \\\n  b'\n  // c"))
+		})
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+		So(resp.Code, ShouldEqual, http.StatusCreated)
+		So(resp.Body.String(), ShouldEqual, "<p> hi </p>")
+
+		resp = httptest.NewRecorder()
+		req, err = http.NewRequest("GET", "/raw", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+		So(resp.Body.String(), ShouldEqual, "<p>\n  hi\n</p>")
+
+		resp = httptest.NewRecorder()
+		req, err = http.NewRequest("GET", "/text", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+		So(resp.Body.String(), ShouldEqual, "a   b")
+
+		resp = httptest.NewRecorder()
+		req, err = http.NewRequest("GET", "/js", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+		So(resp.Body.String(), ShouldEqual, "var s = 'a \\\n  b'")
+	})
+
+	Convey("Minify static files with cache", t, func() {
+		dir, err := ioutil.TempDir("", "bigo-minify")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		name := filepath.Join(dir, "app.css")
+		So(ioutil.WriteFile(name, []byte("a {\n  color: red;\n}\n"), 0644), ShouldBeNil)
+
+		m := New()
+		m.Use(Minifier())
+		m.Use(Static(dir, StaticOptions{SkipLogging: true, Minify: true}))
+
+		get := func() string {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", "/app.css", nil)
+			So(err, ShouldBeNil)
+			m.ServeHTTP(resp, req)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			return resp.Body.String()
+		}
+		So(get(), ShouldEqual, "a{color: red}")
+
+		So(ioutil.WriteFile(name, []byte("b {\n  color: blue;\n}\n"), 0644), ShouldBeNil)
+		later := time.Now().Add(time.Minute)
+		So(os.Chtimes(name, later, later), ShouldBeNil)
+		So(get(), ShouldEqual, "b{color: blue}")
+	})
+}
@@ -0,0 +1,106 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/fym201/bigo"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_RateLimiter(t *testing.T) {
+	Convey("Limit requests with token bucket", t, func() {
+		m := New()
+		m.Use(RateLimiter(RateLimitOptions{Limit: 2, Period: time.Minute}))
+		m.Get("/", func() string { return "ok" })
+
+		do := func(addr string) *httptest.ResponseRecorder {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", "/", nil)
+			So(err, ShouldBeNil)
+			req.RemoteAddr = addr
+			m.ServeHTTP(resp, req)
+			return resp
+		}
+
+		resp := do("10.0.0.1:1234")
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(resp.Header().Get("X-RateLimit-Limit"), ShouldEqual, "2")
+		So(resp.Header().Get("X-RateLimit-Remaining"), ShouldEqual, "1")
+
+		So(do("10.0.0.1:1234").Code, ShouldEqual, http.StatusOK)
+		resp = do("10.0.0.1:1234")
+		So(resp.Code, ShouldEqual, http.StatusTooManyRequests)
+		So(resp.Header().Get("Retry-After"), ShouldEqual, "30")
+
+		So(do("10.0.0.2:1234").Code, ShouldEqual, http.StatusOK)
+	})
+
+	Convey("Limit requests of group with sliding window", t, func() {
+		m := New()
+		m.Get("/", func() string { return "ok" })
+		m.Group("/api", func() {
+			m.Get("/:user", func() string { return "ok" })
+		}, RateLimiter(RateLimitOptions{Limit: 1, Period: time.Hour, Algorithm: SlidingWindow, KeyFunc: KeyByParam(":user")}))
+
+		do := func(path string) int {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", path, nil)
+			So(err, ShouldBeNil)
+			m.ServeHTTP(resp, req)
+			return resp.Code
+		}
+
+		So(do("/api/joe"), ShouldEqual, http.StatusOK)
+		So(do("/api/joe"), ShouldEqual, http.StatusTooManyRequests)
+		So(do("/api/bob"), ShouldEqual, http.StatusOK)
+		So(do("/"), ShouldEqual, http.StatusOK)
+		So(do("/"), ShouldEqual, http.StatusOK)
+	})
+
+	Convey("Refill tokens over time", t, func() {
+		store := NewMemoryRateLimitStore()
+		limit := RateLimit{Limit: 1, Period: 100 * time.Millisecond}
+		r, err := store.Take("key", limit)
+		So(err, ShouldBeNil)
+		So(r.Allowed, ShouldBeTrue)
+		r, _ = store.Take("key", limit)
+		So(r.Allowed, ShouldBeFalse)
+
+		time.Sleep(120 * time.Millisecond)
+		r, _ = store.Take("key", limit)
+		So(r.Allowed, ShouldBeTrue)
+	})
+
+	Convey("Share store between limits of different periods", t, func() {
+		store := NewMemoryRateLimitStore(1)
+		r, _ := store.Take("hour", RateLimit{Limit: 1, Period: time.Hour})
+		So(r.Allowed, ShouldBeTrue)
+
+		// Enough takes of short period to trigger clean up.
+		short := RateLimit{Limit: 1, Period: time.Nanosecond}
+		for i := 0; i < 2048; i++ {
+			store.Take(fmt.Sprintf("short%d", i), short)
+		}
+		r, _ = store.Take("hour", RateLimit{Limit: 1, Period: time.Hour})
+		So(r.Allowed, ShouldBeFalse)
+	})
+}
@@ -18,8 +18,11 @@ package main
 import (
 	"encoding/xml"
 	"html/template"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -395,6 +398,27 @@ func Test_Render_Funcs(t *testing.T) {
 	})
 }
 
+func Test_Render_URLFor(t *testing.T) {
+	Convey("Render HTML with urlfor", t, func() {
+		m := Classic()
+		m.Use(Renderer(RenderOptions{
+			Directory: "fixtures/basic",
+		}))
+		m.Get("/user/:id:int", func() {}).Name("user.show")
+		m.Get("/foobar", func(r Render) {
+			r.HTML(200, "urlfor", nil)
+		})
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/foobar", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(resp.Body.String(), ShouldEqual, `<a href="/user/42">user</a>`)
+	})
+}
+
 func Test_Render_Layout(t *testing.T) {
 	Convey("Render with layout", t, func() {
 		m := Classic()
@@ -572,6 +596,51 @@ func Test_Render_NoRace(t *testing.T) {
 		<-done
 		<-done
 	})
+
+	Convey("Functions of a request do not leak into concurrent ones", t, func() {
+		dir, err := ioutil.TempDir("", "bigo-tmpl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		for name, content := range map[string]string{
+			"layout.tmpl": `{{current}} head {{yield}} {{current}} foot`,
+			"slow.tmpl":   `{{pause}}slow`,
+			"fast.tmpl":   `fast`,
+		} {
+			So(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644), ShouldBeNil)
+		}
+
+		paused, resume := make(chan bool), make(chan bool)
+		m := New()
+		m.Use(Renderer(RenderOptions{
+			Directory: dir,
+			Layout:    "layout",
+			Funcs: []template.FuncMap{{
+				"pause": func() string {
+					paused <- true
+					<-resume
+					return ""
+				},
+			}},
+		}))
+		m.Get("/:name", func(ctx *Context, r Render) {
+			r.HTML(200, ctx.Params(":name"), nil)
+		})
+		get := func(url string) string {
+			resp := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", url, nil)
+			m.ServeHTTP(resp, req)
+			return resp.Body.String()
+		}
+
+		slow := make(chan string)
+		go func() {
+			slow <- get("/slow")
+		}()
+		<-paused
+		So(get("/fast"), ShouldEqual, "fast head fast fast foot")
+		resume <- true
+		So(<-slow, ShouldEqual, "slow head slow slow foot")
+	})
 }
 
 func Test_GetExt(t *testing.T) {
@@ -581,3 +650,233 @@ func Test_GetExt(t *testing.T) {
 		So(GetExt("test.go.tmpl"), ShouldEqual, ".go.tmpl")
 	})
 }
+
+func Test_Render_Reload(t *testing.T) {
+	Convey("Reload changed templates in development mode", t, func() {
+		SetEnv(Dev)
+		dir, err := ioutil.TempDir("", "bigo-tmpl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		name := filepath.Join(dir, "hello.tmpl")
+		write := func(content string, offset time.Duration) {
+			So(ioutil.WriteFile(name, []byte(content), 0644), ShouldBeNil)
+			mtime := time.Now().Add(offset)
+			So(os.Chtimes(name, mtime, mtime), ShouldBeNil)
+		}
+		write("Hello {{.}}", 0)
+
+		m := New()
+		m.Use(Renderer(RenderOptions{Directory: dir}))
+		m.Get("/", func(r Render) {
+			r.HTML(200, "hello", "bigo")
+		})
+		get := func() *httptest.ResponseRecorder {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", "/", nil)
+			So(err, ShouldBeNil)
+			m.ServeHTTP(resp, req)
+			return resp
+		}
+
+		So(get().Body.String(), ShouldEqual, "Hello bigo")
+
+		write("Hi {{.}}", time.Minute)
+		So(get().Body.String(), ShouldEqual, "Hi bigo")
+
+		write("Hi {{.", 2*time.Minute)
+		resp := get()
+		So(resp.Code, ShouldEqual, http.StatusInternalServerError)
+		So(resp.Body.String(), ShouldContainSubstring, "Template Error")
+
+		write("Bye {{.}}", 3*time.Minute)
+		So(get().Body.String(), ShouldEqual, "Bye bigo")
+	})
+
+	Convey("Report templates fail to compile at startup in development mode", t, func() {
+		SetEnv(Dev)
+		dir, err := ioutil.TempDir("", "bigo-tmpl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		So(ioutil.WriteFile(filepath.Join(dir, "bad.tmpl"), []byte("{{end}}"), 0644), ShouldBeNil)
+
+		m := New()
+		So(func() { m.Use(Renderer(RenderOptions{Directory: dir})) }, ShouldNotPanic)
+		m.Get("/", func(r Render) {
+			r.HTML(200, "bad", nil)
+		})
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+		So(resp.Code, ShouldEqual, http.StatusInternalServerError)
+		So(resp.Body.String(), ShouldContainSubstring, "unexpected {{end}}")
+
+		SetEnv(Prod)
+		So(func() { Renderer(RenderOptions{Directory: dir}) }, ShouldPanic)
+		SetEnv(Dev)
+	})
+}
+
+func Test_Render_Inheritance(t *testing.T) {
+	Convey("Render templates with blocks, partials and layouts", t, func() {
+		dir, err := ioutil.TempDir("", "bigo-tmpl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		adminDir := filepath.Join(dir, "admin")
+		So(os.Mkdir(adminDir, 0755), ShouldBeNil)
+		for name, content := range map[string]string{
+			"base.tmpl":         `<title>{{block "title" .}}Default{{end}}</title><main>{{block "content" .}}{{end}}</main>`,
+			"section.tmpl":      `{{extends "base"}}{{define "title"}}Section{{end}}`,
+			"page.tmpl":         `{{extends "section"}}{{define "content"}}Page {{.}} {{partial "item" "Name" "x"}}{{end}}`,
+			"other.tmpl":        "{{extends \"base\"}}\n{{define \"content\"}}Other{{end}}",
+			"item.tmpl":         `<i>{{.Name}}</i>`,
+			"layout.tmpl":       `[public]{{yield}}`,
+			"admin/layout.tmpl": `[admin]{{yield}}`,
+			"admin/index.tmpl":  `hi`,
+		} {
+			So(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644), ShouldBeNil)
+		}
+
+		m := New()
+		m.Use(Renderers(RenderOptions{Directory: dir, SetLayouts: map[string]string{"admin": "layout"}}, "admin:"+adminDir))
+		m.Get("/page", func(r Render) {
+			r.HTML(200, "page", "bigo")
+		})
+		m.Get("/other", func(ctx *Context) {
+			ctx.Data["Layout"] = "layout"
+			ctx.HTML(200, "other")
+		})
+		m.Get("/admin", func(r Render) {
+			r.HTMLSet(200, "admin", "index", nil)
+		})
+		m.Get("/admin/raw", func(ctx *Context, r Render) {
+			ctx.Data["Layout"] = ""
+			r.HTMLSet(200, "admin", "index", nil)
+		})
+		get := func(url string) string {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", url, nil)
+			So(err, ShouldBeNil)
+			m.ServeHTTP(resp, req)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			return resp.Body.String()
+		}
+
+		So(get("/page"), ShouldEqual, "<title>Section</title><main>Page bigo <i>x</i></main>")
+		So(get("/other"), ShouldEqual, "[public]<title>Default</title><main>Other</main>")
+		So(get("/admin"), ShouldEqual, "[admin]hi")
+		So(get("/admin/raw"), ShouldEqual, "hi")
+	})
+}
+
+func Test_Render_Engine(t *testing.T) {
+	Convey("Render templates with engines by extension and set", t, func() {
+		dir, err := ioutil.TempDir("", "bigo-tmpl")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		mailDir := filepath.Join(dir, "mail")
+		So(os.Mkdir(mailDir, 0755), ShouldBeNil)
+		for name, content := range map[string]string{
+			"page.tmpl":    `<b>{{.}}</b> {{partial "note" .}}`,
+			"note.txt":     `<i>{{.}}</i>`,
+			"mail/hi.tmpl": `Hi {{.}}`,
+		} {
+			So(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644), ShouldBeNil)
+		}
+
+		m := New()
+		m.Use(Renderers(RenderOptions{
+			Directory:        dir,
+			Extensions:       []string{".tmpl", ".txt"},
+			ExtensionEngines: map[string]TemplateEngine{".txt": TextEngine},
+			SetEngines:       map[string]TemplateEngine{"mail": TextEngine},
+		}, "mail:"+mailDir))
+		m.Get("/page", func(r Render) {
+			r.HTML(200, "page", "<x>")
+		})
+		m.Get("/note", func(r Render) {
+			r.HTML(200, "note", "<x>")
+		})
+		m.Get("/mail", func(r Render) {
+			r.HTMLSet(200, "mail", "hi", "<x>")
+		})
+		get := func(url string) string {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", url, nil)
+			So(err, ShouldBeNil)
+			m.ServeHTTP(resp, req)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			return resp.Body.String()
+		}
+
+		So(get("/page"), ShouldEqual, "<b>&lt;x&gt;</b> <i><x></i>")
+		So(get("/note"), ShouldEqual, "<i><x></i>")
+		So(get("/mail"), ShouldEqual, "Hi <x>")
+	})
+}
+
+func Test_Render_Negotiate(t *testing.T) {
+	Convey("Render data in format chosen by Accept header", t, func() {
+		RegisterEncoder("application/x-test", func(v interface{}) ([]byte, error) {
+			return []byte("test:" + v.(Greeting).One), nil
+		})
+
+		m := New()
+		m.Use(Renderer(RenderOptions{
+			Directory: "fixtures/basic",
+		}))
+		m.Get("/greeting", func(ctx *Context) {
+			ctx.Negotiate(200, Greeting{"hello", "world"}, NegotiateOptions{Template: "hello"})
+		})
+		m.Get("/data", func(r Render) {
+			r.Negotiate(200, Greeting{"hello", "world"}, NegotiateOptions{Offers: []string{ContentJSON}})
+		})
+		get := func(url, accept string) *httptest.ResponseRecorder {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", url, nil)
+			So(err, ShouldBeNil)
+			req.Header.Set("Accept", accept)
+			m.ServeHTTP(resp, req)
+			So(resp.Header().Get("Vary"), ShouldEqual, "Accept")
+			return resp
+		}
+
+		resp := get("/greeting", "text/html,application/xhtml+xml,*/*;q=0.8")
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(resp.Header().Get(ContentType), ShouldEqual, ContentHTML+"; charset=UTF-8")
+		So(resp.Body.String(), ShouldEqual, "<h1>Hello {hello world}</h1>")
+
+		resp = get("/greeting", "text/html;q=0.5, application/json")
+		So(resp.Header().Get(ContentType), ShouldEqual, ContentJSON+"; charset=UTF-8")
+		So(resp.Body.String(), ShouldEqual, `{"one":"hello","two":"world"}`)
+
+		resp = get("/greeting", "application/xml")
+		So(resp.Header().Get(ContentType), ShouldEqual, ContentXML+"; charset=UTF-8")
+		So(resp.Body.String(), ShouldEqual, "<Greeting><One>hello</One><Two>world</Two></Greeting>")
+
+		resp = get("/greeting", "text/plain")
+		So(resp.Header().Get(ContentType), ShouldEqual, CONTENT_PLAIN+"; charset=UTF-8")
+		So(resp.Body.String(), ShouldEqual, "{hello world}")
+
+		resp = get("/greeting", "application/x-test, text/*;q=0.1")
+		So(resp.Header().Get(ContentType), ShouldEqual, "application/x-test")
+		So(resp.Body.String(), ShouldEqual, "test:hello")
+
+		resp = get("/data", "text/html, application/*;q=0")
+		So(resp.Code, ShouldEqual, http.StatusNotAcceptable)
+
+		resp = get("/data", "")
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(resp.Header().Get(ContentType), ShouldEqual, ContentJSON+"; charset=UTF-8")
+	})
+
+	Convey("Negotiate content type with q values", t, func() {
+		offers := []string{"text/html", "application/json"}
+		So(NegotiateContentType("", offers), ShouldEqual, "text/html")
+		So(NegotiateContentType("*/*", offers), ShouldEqual, "text/html")
+		So(NegotiateContentType("application/*, text/html;q=0.9", offers), ShouldEqual, "application/json")
+		So(NegotiateContentType("*/*;q=0.5, text/html;q=0", offers), ShouldEqual, "application/json")
+		So(NegotiateContentType("image/png", offers), ShouldEqual, "")
+	})
+}
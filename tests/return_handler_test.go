@@ -15,8 +15,11 @@
 package main
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	. "github.com/fym201/bigo"
@@ -68,4 +71,86 @@ func Test_Return_Handler(t *testing.T) {
 
 		So(resp.Body.String(), ShouldEqual, "hello world")
 	})
+
+	Convey("Return with struct and map", t, func() {
+		m := New()
+		m.Get("/struct", func() (int, interface{}) {
+			return 201, struct {
+				Name string `json:"name"`
+			}{"bigo"}
+		})
+		m.Get("/map", func() map[string]int {
+			return map[string]int{"count": 1}
+		})
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/struct", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+
+		So(resp.Code, ShouldEqual, http.StatusCreated)
+		So(resp.Header().Get("Content-Type"), ShouldEqual, "application/json; charset=UTF-8")
+		So(resp.Body.String(), ShouldEqual, `{"name":"bigo"}`)
+
+		resp = httptest.NewRecorder()
+		req, err = http.NewRequest("GET", "/map", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(resp.Body.String(), ShouldEqual, `{"count":1}`)
+	})
+
+	Convey("Return with error", t, func() {
+		m := New()
+		m.Get("/missing", func() (string, error) {
+			return "", NewHTTPError(404, "no such user")
+		})
+		m.Get("/broken", func() error {
+			return errors.New("database is down")
+		})
+		m.Get("/ok", func() (string, error) {
+			return "fine", nil
+		})
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/missing", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+
+		So(resp.Code, ShouldEqual, http.StatusNotFound)
+		So(resp.Body.String(), ShouldEqual, "no such user\n")
+
+		resp = httptest.NewRecorder()
+		req, err = http.NewRequest("GET", "/broken", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+
+		So(resp.Code, ShouldEqual, http.StatusInternalServerError)
+		So(resp.Body.String(), ShouldNotContainSubstring, "database")
+
+		resp = httptest.NewRecorder()
+		req, err = http.NewRequest("GET", "/ok", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(resp.Body.String(), ShouldEqual, "fine")
+	})
+
+	Convey("Return with status, headers and reader", t, func() {
+		m := New()
+		m.Get("/", func() (int, http.Header, io.Reader) {
+			return 202, http.Header{"X-Answer": {"42"}}, strings.NewReader("streamed")
+		})
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+
+		So(resp.Code, ShouldEqual, http.StatusAccepted)
+		So(resp.Header().Get("X-Answer"), ShouldEqual, "42")
+		So(resp.Body.String(), ShouldEqual, "streamed")
+	})
 }
@@ -199,3 +199,123 @@ func Test_Router_splat(t *testing.T) {
 		So(resp.Body.String(), ShouldEqual, "hahaha")
 	})
 }
+
+func Test_Router_URLFor(t *testing.T) {
+	Convey("Build URLs from named routes", t, func() {
+		m := New()
+		m.Get("/", func() {}).Name("home")
+		m.Get("/user/:id:int", func() {}).Name("user.show")
+		m.Get("/user/:name:string/posts/?:page", func() {}).Name("user.posts")
+		m.Get("/cms_:id([0-9]+)_:page.html", func() {}).Name("cms")
+		m.Get("/files/*", func() {}).Name("files")
+		m.Get("/static/*.*", func() {}).Name("static")
+		m.Group("/admin", func() {
+			m.Combo("/users/:uid/").Get(func() {}).Post(func() {}).Name("admin.user")
+		})
+
+		So(m.URLFor("home"), ShouldEqual, "/")
+		So(m.URLFor("user.show", ":id", 12), ShouldEqual, "/user/12")
+		So(m.URLFor("user.posts", "name", "joe"), ShouldEqual, "/user/joe/posts")
+		So(m.URLFor("user.posts", "name", "joe", "page", 2), ShouldEqual, "/user/joe/posts/2")
+		So(m.URLFor("cms", ":id", 3, ":page", "about"), ShouldEqual, "/cms_3_about.html")
+		So(m.URLFor("files", "*", "a/b.txt"), ShouldEqual, "/files/a/b.txt")
+		So(m.URLFor("static", ":path", "js/app", ":ext", "js"), ShouldEqual, "/static/js/app.js")
+		So(m.URLFor("admin.user", ":uid", "x"), ShouldEqual, "/admin/users/x/")
+		So(m.URLFor("admin.user", ":uid", "a/b?c"), ShouldEqual, "/admin/users/a%2Fb%3Fc/")
+		So(m.URLFor("files", "*", "a b/c?.txt"), ShouldEqual, "/files/a%20b/c%3F.txt")
+
+		m.SetURLPrefix("/prefix")
+		So(m.URLFor("user.show", ":id", 12), ShouldEqual, "/prefix/user/12")
+
+		Convey("Built URL matches the route", func() {
+			m := New()
+			m.Get("/user/:id:int", func(ctx *Context) string {
+				return ctx.Params(":id")
+			}).Name("user.show")
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", m.URLFor("user.show", ":id", 12), nil)
+			So(err, ShouldBeNil)
+			m.ServeHTTP(resp, req)
+			So(resp.Body.String(), ShouldEqual, "12")
+		})
+
+		Convey("Param does not match restriction", func() {
+			defer func() {
+				So(recover(), ShouldNotBeNil)
+			}()
+			m.URLFor("user.show", ":id", "abc")
+		})
+
+		Convey("Missing param", func() {
+			defer func() {
+				So(recover(), ShouldNotBeNil)
+			}()
+			m.URLFor("user.show")
+		})
+
+		Convey("Unknown route name", func() {
+			defer func() {
+				So(recover(), ShouldNotBeNil)
+			}()
+			m.URLFor("404")
+		})
+
+		Convey("Duplicated route name", func() {
+			defer func() {
+				So(recover(), ShouldNotBeNil)
+			}()
+			m.Get("/other", func() {}).Name("home")
+		})
+	})
+}
+
+func Test_Router_MethodNotAllowed(t *testing.T) {
+	Convey("Respond 405 with Allow header", t, func() {
+		m := New()
+		m.Get("/user/:id", func() string { return "get" })
+		m.Put("/user/:id", func() string { return "put" })
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("DELETE", "/user/1", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+		So(resp.Code, ShouldEqual, http.StatusMethodNotAllowed)
+		So(resp.Header().Get("Allow"), ShouldEqual, "GET, HEAD, OPTIONS, PUT")
+
+		resp = httptest.NewRecorder()
+		req, err = http.NewRequest("DELETE", "/post/1", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+		So(resp.Code, ShouldEqual, http.StatusNotFound)
+
+		Convey("Custom handler", func() {
+			m.MethodNotAllowed(func(ctx *Context) {
+				ctx.Resp.WriteHeader(http.StatusMethodNotAllowed)
+				ctx.Resp.Write([]byte("custom 405: " + ctx.Resp.Header().Get("Allow")))
+			})
+
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("POST", "/user/1", nil)
+			So(err, ShouldBeNil)
+			m.ServeHTTP(resp, req)
+			So(resp.Code, ShouldEqual, http.StatusMethodNotAllowed)
+			So(resp.Body.String(), ShouldEqual, "custom 405: GET, HEAD, OPTIONS, PUT")
+		})
+	})
+
+	Convey("Serve HEAD request by GET route", t, func() {
+		m := New()
+		m.Get("/", func(ctx *Context) string {
+			ctx.Resp.Header().Set("X-Method", ctx.Req.Method)
+			return "get"
+		})
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("HEAD", "/", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(resp.Header().Get("X-Method"), ShouldEqual, "HEAD")
+		So(resp.Body.Len(), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,176 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/fym201/bigo"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func testSessionProvider(opt SessionOptions) {
+	m := New()
+	m.Use(Sessioner(opt))
+	m.Get("/set", func(sess Session) string {
+		sess.Set("uname", "unknwon")
+		return "set"
+	})
+	m.Get("/get", func(sess Session) string {
+		So(sess.Get("uname"), ShouldEqual, "unknwon")
+		return "get"
+	})
+	m.Get("/regenerate", func(ctx *Context, sess Session) string {
+		oldsid := sess.ID()
+		_, err := sess.RegenerateId(ctx)
+		So(err, ShouldBeNil)
+		So(sess.ID(), ShouldNotEqual, oldsid)
+		So(sess.Get("uname"), ShouldEqual, "unknwon")
+		return "regenerate"
+	})
+	m.Get("/destroy", func(ctx *Context, sess Session) string {
+		So(sess.Destroy(ctx), ShouldBeNil)
+		return "destroy"
+	})
+
+	do := func(path, cookie string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", path, nil)
+		So(err, ShouldBeNil)
+		if len(cookie) > 0 {
+			req.Header.Set("Cookie", cookie)
+		}
+		m.ServeHTTP(resp, req)
+		return resp
+	}
+	sessCookie := func(resp *httptest.ResponseRecorder) string {
+		cookie := resp.Header().Get("Set-Cookie")
+		So(cookie, ShouldStartWith, "BigoSession=")
+		return strings.Split(cookie, ";")[0]
+	}
+
+	cookie := sessCookie(do("/set", ""))
+	do("/get", cookie)
+
+	cookie = sessCookie(do("/regenerate", cookie))
+	do("/get", cookie)
+
+	resp := do("/destroy", cookie)
+	So(resp.Header().Get("Set-Cookie"), ShouldContainSubstring, "Max-Age=0")
+
+	resp = do("/set", cookie)
+	So(sessCookie(resp), ShouldNotEqual, cookie)
+}
+
+type gcCountProvider struct {
+	MemSessionProvider
+	gc int
+}
+
+func (p *gcCountProvider) GC() {
+	p.gc++
+	p.MemSessionProvider.GC()
+}
+
+func Test_Sessioner(t *testing.T) {
+	Convey("Use session middleware", t, func() {
+		m := New()
+		m.Use(Sessioner())
+		m.Get("/", func(sess Session) string {
+			So(len(sess.ID()), ShouldEqual, 32)
+			return sess.ID()
+		})
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		So(err, ShouldBeNil)
+		m.ServeHTTP(resp, req)
+		So(resp.Header().Get("Set-Cookie"), ShouldStartWith, "BigoSession="+resp.Body.String())
+	})
+
+	Convey("Use memory session provider", t, func() {
+		testSessionProvider(SessionOptions{})
+	})
+
+	Convey("Use file session provider", t, func() {
+		defer os.RemoveAll("data/sessions")
+		testSessionProvider(SessionOptions{Provider: "file", ProviderConfig: "data/sessions"})
+	})
+
+	Convey("Keep file sessions private", t, func() {
+		defer os.RemoveAll("data/sessions")
+		p := &FileSessionProvider{}
+		So(p.Init(3600, "data/sessions"), ShouldBeNil)
+		sid := "0123456789abcdef0123456789abcdef"
+		store, err := p.Read(sid)
+		So(err, ShouldBeNil)
+		So(store.Set("uname", "bigo"), ShouldBeNil)
+		So(store.Release(), ShouldBeNil)
+
+		fi, err := os.Stat("data/sessions")
+		So(err, ShouldBeNil)
+		So(fi.Mode().Perm(), ShouldEqual, os.FileMode(0700))
+		fi, err = os.Stat("data/sessions/0/1/" + sid)
+		So(err, ShouldBeNil)
+		So(fi.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+	})
+
+	Convey("Use cookie session provider", t, func() {
+		testSessionProvider(SessionOptions{Provider: "cookie", ProviderConfig: "session-secret"})
+	})
+
+	Convey("Require cookie session secret", t, func() {
+		m := New()
+		m.SetCookieCodec(NewCookieCodec())
+		_, err := NewSessionManager("cookie", SessionOptions{})
+		So(err, ShouldNotBeNil)
+		_, err = NewSessionManager("cookie", SessionOptions{ProviderConfig: "new-secret,"})
+		So(err, ShouldNotBeNil)
+
+		m.SetDefaultCookieSecret("session-secret")
+		_, err = NewSessionManager("cookie", SessionOptions{})
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Stop session GC on shutdown", t, func() {
+		provider := &gcCountProvider{}
+		RegisterSessionProvider("gccount", provider)
+
+		m := New()
+		m.Use(Sessioner(SessionOptions{Provider: "gccount"}))
+		m.Get("/", func() {})
+		for i := 0; i < 2; i++ {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", "/", nil)
+			So(err, ShouldBeNil)
+			m.ServeHTTP(resp, req)
+		}
+		So(provider.gc, ShouldEqual, 1)
+		So(m.Shutdown(context.Background()), ShouldBeNil)
+	})
+
+	Convey("Use unregistered session provider", t, func() {
+		defer func() {
+			So(recover(), ShouldNotBeNil)
+		}()
+		Sessioner(SessionOptions{Provider: "unknown"})
+	})
+}
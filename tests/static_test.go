@@ -17,11 +17,17 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"html/template"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -246,3 +252,241 @@ func Test_Statics(t *testing.T) {
 		})
 	})
 }
+
+func Test_Static_Compressed(t *testing.T) {
+	Convey("Serve compressed static files", t, func() {
+		dir, err := ioutil.TempDir("", "bigo-static")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		content := strings.Repeat("var a = 1;\n", 100)
+		So(ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte(content), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "app.css"), []byte("body{}"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "app.css.br"), []byte("brotli"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "app.txt"), []byte("text"), 0644), ShouldBeNil)
+
+		m := New()
+		m.Use(Gziper())
+		m.Use(Static(dir, StaticOptions{SkipLogging: true, GzipExtensions: []string{".js", "css"}}))
+
+		get := func(name, accept, rng string) *httptest.ResponseRecorder {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", name, nil)
+			So(err, ShouldBeNil)
+			if len(accept) > 0 {
+				req.Header.Set("Accept-Encoding", accept)
+			}
+			if len(rng) > 0 {
+				req.Header.Set("Range", rng)
+			}
+			m.ServeHTTP(resp, req)
+			return resp
+		}
+
+		resp := get("/app.js", "gzip, deflate", "")
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(resp.Header().Get("Content-Encoding"), ShouldEqual, "gzip")
+		So(resp.Header().Get("Vary"), ShouldEqual, "Accept-Encoding")
+		So(resp.Header().Get("Content-Type"), ShouldContainSubstring, "javascript")
+		gz, err := gzip.NewReader(resp.Body)
+		So(err, ShouldBeNil)
+		data, err := ioutil.ReadAll(gz)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, content)
+
+		resp = get("/app.js", "gzip", "bytes=0-1")
+		So(resp.Code, ShouldEqual, http.StatusPartialContent)
+		So(resp.Body.Bytes(), ShouldResemble, []byte{0x1f, 0x8b})
+
+		resp = get("/app.js", "gzip;q=0", "")
+		So(resp.Header().Get("Content-Encoding"), ShouldBeBlank)
+		So(resp.Header().Get("Vary"), ShouldEqual, "Accept-Encoding")
+		So(resp.Body.String(), ShouldEqual, content)
+
+		resp = get("/app.css", "gzip, br", "")
+		So(resp.Header().Get("Content-Encoding"), ShouldEqual, "br")
+		So(resp.Header().Get("Content-Type"), ShouldContainSubstring, "text/css")
+		So(resp.Body.String(), ShouldEqual, "brotli")
+
+		resp = get("/app.txt", "gzip", "")
+		So(resp.Header().Get("Content-Encoding"), ShouldEqual, "gzip")
+		gz, err = gzip.NewReader(resp.Body)
+		So(err, ShouldBeNil)
+		data, err = ioutil.ReadAll(gz)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, "text")
+
+		Convey("Keep Vary set by other middlewares", func() {
+			m := New()
+			m.Use(func(ctx *Context) {
+				ctx.Resp.Header().Add("Vary", "Origin")
+			})
+			m.Use(Static(dir, StaticOptions{SkipLogging: true, GzipExtensions: []string{".js"}}))
+
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", "/app.js", nil)
+			So(err, ShouldBeNil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			m.ServeHTTP(resp, req)
+			So(resp.Header()["Vary"], ShouldResemble, []string{"Origin", "Accept-Encoding"})
+		})
+
+		Convey("Evict compressed files beyond cache size", func() {
+			opens := func(size int64) int {
+				fs := &openCountFS{FileSystem: http.Dir(dir), opens: map[string]int{}}
+				m := New()
+				m.Use(Static(dir, StaticOptions{SkipLogging: true, GzipExtensions: []string{".js"}, FileSystem: fs, CacheSize: size}))
+				for i := 0; i < 2; i++ {
+					resp := httptest.NewRecorder()
+					req, err := http.NewRequest("GET", "/app.js", nil)
+					So(err, ShouldBeNil)
+					req.Header.Set("Accept-Encoding", "gzip")
+					m.ServeHTTP(resp, req)
+					So(resp.Code, ShouldEqual, http.StatusOK)
+				}
+				return fs.opens["/app.js"]
+			}
+			// File is opened once by each request, and read again for compressing if not cached.
+			So(opens(0), ShouldEqual, 3)
+			So(opens(1), ShouldEqual, 4)
+		})
+	})
+}
+
+// openCountFS counts how many times each file is opened.
+type openCountFS struct {
+	http.FileSystem
+	opens map[string]int
+}
+
+func (fs *openCountFS) Open(name string) (http.File, error) {
+	fs.opens[name]++
+	return fs.FileSystem.Open(name)
+}
+
+func Test_Static_Caching(t *testing.T) {
+	Convey("Serve static files with ETag, Cache-Control and fingerprint", t, func() {
+		dir, err := ioutil.TempDir("", "bigo-static")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		So(os.Mkdir(filepath.Join(dir, "img"), 0755), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte("var a = 1;"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "img", "logo.png"), []byte("png"), 0644), ShouldBeNil)
+
+		m := New()
+		m.Use(Static(dir, StaticOptions{
+			Prefix:       "assets",
+			SkipLogging:  true,
+			ETag:         true,
+			CacheControl: map[string]string{".js": "public, max-age=60", "/img/": "public, max-age=3600", "*": "no-cache"},
+			Fingerprint:  true,
+		}))
+		m.Use(Static(dir, StaticOptions{Prefix: "weak", SkipLogging: true, ETag: true, WeakETag: true}))
+		m.Use(Renderer(RenderOptions{Directory: "fixtures/basic"}))
+		m.Get("/page", func(ctx *Context) {
+			ctx.HTML(200, "asset")
+		})
+
+		get := func(name, etag string) *httptest.ResponseRecorder {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", name, nil)
+			So(err, ShouldBeNil)
+			if len(etag) > 0 {
+				req.Header.Set("If-None-Match", etag)
+			}
+			m.ServeHTTP(resp, req)
+			return resp
+		}
+
+		resp := get("/assets/app.js", "")
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		etag := resp.Header().Get("ETag")
+		So(etag, ShouldEqual, fmt.Sprintf(`"%x"`, sha1.Sum([]byte("var a = 1;"))))
+		So(resp.Header().Get("Cache-Control"), ShouldEqual, "public, max-age=60")
+		So(get("/assets/app.js", etag).Code, ShouldEqual, http.StatusNotModified)
+
+		So(get("/assets/img/logo.png", "").Header().Get("Cache-Control"), ShouldEqual, "public, max-age=3600")
+
+		resp = get("/weak/app.js", "")
+		So(resp.Header().Get("ETag"), ShouldStartWith, `W/"`)
+		So(resp.Header().Get("Cache-Control"), ShouldBeBlank)
+
+		url := Asset("/assets/app.js")
+		So(url, ShouldEqual, "/assets/app."+etag[1:9]+".js")
+		So(Asset("/assets/missing.js"), ShouldEqual, "/assets/missing.js")
+		So(Asset("/weak/app.js"), ShouldEqual, "/weak/app.js")
+
+		resp = get(url, "")
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(resp.Header().Get("Cache-Control"), ShouldEqual, "public, max-age=31536000, immutable")
+		So(resp.Body.String(), ShouldEqual, "var a = 1;")
+
+		resp = get("/assets/app.00000000.js", "")
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(resp.Header().Get("Cache-Control"), ShouldEqual, "public, max-age=60")
+
+		resp = get("/page", "")
+		So(resp.Body.String(), ShouldEqual, `<script src="`+url+`"></script>`)
+	})
+}
+
+func Test_Static_Listing(t *testing.T) {
+	Convey("List directories without index file", t, func() {
+		dir, err := ioutil.TempDir("", "bigo-static")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		So(os.Mkdir(filepath.Join(dir, "sub"), 0755), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "b.txt"), []byte(strings.Repeat("b", 2048)), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, ".secret"), []byte("s"), 0644), ShouldBeNil)
+
+		m := New()
+		m.Use(Static(dir, StaticOptions{Prefix: "files", SkipLogging: true, Listing: true}))
+
+		get := func(url, accept string) *httptest.ResponseRecorder {
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", url, nil)
+			So(err, ShouldBeNil)
+			if len(accept) > 0 {
+				req.Header.Set("Accept", accept)
+			}
+			m.ServeHTTP(resp, req)
+			return resp
+		}
+
+		resp := get("/files/", "")
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(resp.Header().Get("Content-Type"), ShouldStartWith, "text/html")
+		body := resp.Body.String()
+		So(body, ShouldContainSubstring, `<a href="sub/">sub/</a>`)
+		So(body, ShouldContainSubstring, "2.0KB")
+		So(body, ShouldNotContainSubstring, ".secret")
+		So(body, ShouldNotContainSubstring, `href="../"`)
+		So(strings.Index(body, "a.txt"), ShouldBeLessThan, strings.Index(body, "b.txt"))
+
+		var l DirListing
+		resp = get("/files/?sort=size&order=desc", "application/json")
+		So(resp.Header().Get("Content-Type"), ShouldStartWith, "application/json")
+		So(json.Unmarshal(resp.Body.Bytes(), &l), ShouldBeNil)
+		So(l.Sort, ShouldEqual, "size")
+		So(len(l.Entries), ShouldEqual, 3)
+		So(l.Entries[0].Name, ShouldEqual, "sub")
+		So(l.Entries[1].Name, ShouldEqual, "b.txt")
+		So(l.Entries[1].Size, ShouldEqual, 2048)
+
+		So(get("/files/sub/", "").Body.String(), ShouldContainSubstring, `href="../"`)
+
+		So(os.MkdirAll(filepath.Join(dir, ".git", "refs"), 0755), ShouldBeNil)
+		So(get("/files/.git/", "").Code, ShouldEqual, http.StatusNotFound)
+		So(get("/files/.git/refs/", "").Code, ShouldEqual, http.StatusNotFound)
+
+		m = New()
+		m.Use(Static(dir, StaticOptions{SkipLogging: true, Listing: true, ShowHidden: true,
+			ListingTemplate: template.Must(template.New("").Parse(`{{range .Entries}}{{.Name}};{{end}}`))}))
+		So(get("/", "").Body.String(), ShouldEqual, ".git;sub;.secret;a.txt;b.txt;")
+		So(get("/.git/", "").Body.String(), ShouldEqual, "refs;")
+
+		m = New()
+		m.Use(Static(dir, StaticOptions{SkipLogging: true}))
+		So(get("/", "").Code, ShouldEqual, http.StatusNotFound)
+	})
+}
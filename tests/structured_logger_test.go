@@ -0,0 +1,125 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/fym201/bigo"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_StructuredLogger(t *testing.T) {
+	Convey("Log with fields in text format", t, func() {
+		ColorLog = false
+		buf := bytes.NewBufferString("")
+		l := NewLogger(buf, "", 0)
+		l.SetLevel(LogLevelInfo)
+		l.With("user", "joe").Info("login", "ok", true, "note", "first time")
+		So(buf.String(), ShouldEqual, "[INFO] login user=joe ok=true note=\"first time\"\n")
+
+		Convey("Filter by level", func() {
+			buf.Reset()
+			l.SetLevel(LogLevelError)
+			l.With("user", "joe").Info("login")
+			So(buf.Len(), ShouldEqual, 0)
+			l.Error("failed", "code", 1)
+			So(buf.String(), ShouldEqual, "[ERROR] failed code=1\n")
+
+			buf.Reset()
+			l.SetLevel(LogLevelNone)
+			l.LogError("failed")
+			So(buf.Len(), ShouldEqual, 0)
+		})
+	})
+
+	Convey("Log with fields in JSON format", t, func() {
+		buf := bytes.NewBufferString("")
+		l := NewLogger(buf, "[Bigo] ", log.LstdFlags)
+		l.SetLevel(LogLevelInfo)
+		l.SetFormat(LogFormatJSON)
+		l.With("user", "joe").Info("login", "count", 2)
+
+		var entry map[string]interface{}
+		So(json.Unmarshal(buf.Bytes(), &entry), ShouldBeNil)
+		So(entry["level"], ShouldEqual, "info")
+		So(entry["msg"], ShouldEqual, "login")
+		So(entry["user"], ShouldEqual, "joe")
+		So(entry["count"], ShouldEqual, 2)
+		So(entry["time"], ShouldNotBeEmpty)
+	})
+
+	Convey("Map request-scoped logger into context", t, func() {
+		buf := bytes.NewBufferString("")
+		l := NewLogger(buf, "", 0)
+		l.SetLevel(LogLevelInfo)
+		l.SetFormat(LogFormatJSON)
+		m := NewWithLogger(l)
+		m.Use(ReqLogger())
+		m.Get("/", func(ctx *Context, log *Logger) {
+			So(log, ShouldEqual, ctx.Logger())
+		})
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		So(err, ShouldBeNil)
+		req.Header.Set("X-Request-Id", "abc")
+		m.ServeHTTP(resp, req)
+
+		lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+		So(len(lines), ShouldEqual, 2)
+		var entry map[string]interface{}
+		So(json.Unmarshal(lines[1], &entry), ShouldBeNil)
+		So(entry["request_id"], ShouldEqual, "abc")
+		So(entry["method"], ShouldEqual, "GET")
+		So(entry["path"], ShouldEqual, "/")
+		So(entry["status"], ShouldEqual, 200)
+		So(entry["latency"], ShouldNotBeEmpty)
+	})
+
+	Convey("Color completed line by status in text format", t, func() {
+		ColorLog = true
+		defer func() { ColorLog = false }()
+		buf := bytes.NewBufferString("")
+		l := NewLogger(buf, "", 0)
+		l.SetLevel(LogLevelInfo)
+		m := NewWithLogger(l)
+		m.Use(ReqLogger())
+		m.Get("/", func() {})
+		m.Get("/cached", func(ctx *Context) {
+			ctx.Resp.WriteHeader(http.StatusNotModified)
+		})
+
+		for path, color := range map[string]string{
+			"/":        "\033[1;32m[INFO] Completed / 200 OK",
+			"/cached":  "\033[1;33m[INFO] Completed /cached 304 Not Modified",
+			"/missing": "\033[1;31m[INFO] Completed /missing 404 Not Found",
+		} {
+			buf.Reset()
+			resp := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", path, nil)
+			So(err, ShouldBeNil)
+			req.RequestURI = path
+			m.ServeHTTP(resp, req)
+			So(buf.String(), ShouldContainSubstring, color)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/fym201/bigo"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func Test_Tracer(t *testing.T) {
+	Convey("Continue trace from request headers", t, func() {
+		var buf bytes.Buffer
+		m := NewWithLogger(NewLogger(&buf, "", 0))
+		m.Use(Tracer(TraceOptions{ResponseHeader: true}))
+		var header http.Header
+		m.Get("/", func(ctx *Context, trace *TraceContext, log *Logger) {
+			header = ctx.TraceHeader(http.Header{"Accept": {"*/*"}})
+			So(ctx.Data["TraceID"], ShouldEqual, trace.TraceID)
+			log.Info("handled")
+		})
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		So(err, ShouldBeNil)
+		req.Header.Set("X-Request-Id", "req-1")
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		req.Header.Set("tracestate", "congo=t61rcWkgMzE")
+		m.ServeHTTP(resp, req)
+
+		So(resp.Header().Get("X-Request-Id"), ShouldEqual, "req-1")
+		So(header.Get("Accept"), ShouldEqual, "*/*")
+		So(header.Get("X-Request-Id"), ShouldEqual, "req-1")
+		So(header.Get("tracestate"), ShouldEqual, "congo=t61rcWkgMzE")
+		traceID, parentID, flags, ok := ParseTraceParent(header.Get("traceparent"))
+		So(ok, ShouldBeTrue)
+		So(traceID, ShouldEqual, "4bf92f3577b34da6a3ce929d0e0e4736")
+		So(parentID, ShouldNotEqual, "00f067aa0ba902b7")
+		So(flags, ShouldEqual, "01")
+		So(buf.String(), ShouldContainSubstring, "request_id=req-1 trace_id=4bf92f3577b34da6a3ce929d0e0e4736 span_id="+parentID)
+	})
+
+	Convey("Start new trace for invalid headers", t, func() {
+		m := New()
+		m.Use(Tracer())
+		var trace *TraceContext
+		m.Get("/", func(ctx *Context) {
+			trace = ctx.Trace()
+		})
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		So(err, ShouldBeNil)
+		req.Header.Set("X-Request-Id", "bad id\n")
+		req.Header.Set("traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+		req.Header.Set("tracestate", "congo=t61rcWkgMzE")
+		m.ServeHTTP(resp, req)
+
+		So(resp.Header().Get("X-Request-Id"), ShouldBeEmpty)
+		So(trace.RequestID, ShouldNotEqual, "bad id\n")
+		So(len(trace.TraceID), ShouldEqual, 32)
+		So(trace.ParentID, ShouldBeEmpty)
+		So(trace.State, ShouldBeEmpty)
+		So(strings.HasPrefix(trace.TraceParent(), "00-"+trace.TraceID+"-"+trace.SpanID), ShouldBeTrue)
+	})
+
+	Convey("Reject request ID with markup on panic page", t, func() {
+		m := New()
+		m.Use(Recovery())
+		m.Get("/", func() {
+			panic("here is a panic!")
+		})
+
+		resp := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/", nil)
+		So(err, ShouldBeNil)
+		req.Header.Set("X-Request-Id", `"><script>alert(1)</script>`)
+		m.ServeHTTP(resp, req)
+
+		So(resp.Code, ShouldEqual, http.StatusInternalServerError)
+		So(resp.Body.String(), ShouldNotContainSubstring, "<script>")
+	})
+
+	Convey("Parse traceparent header", t, func() {
+		_, _, _, ok := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		So(ok, ShouldBeTrue)
+		_, _, _, ok = ParseTraceParent("ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		So(ok, ShouldBeFalse)
+		_, _, _, ok = ParseTraceParent("00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01")
+		So(ok, ShouldBeFalse)
+		_, _, _, ok = ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+		So(ok, ShouldBeTrue)
+	})
+}
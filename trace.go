@@ -0,0 +1,203 @@
+// Copyright 2014 bigo
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package bigo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+const (
+	HeaderRequestID   = "X-Request-Id"
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+)
+
+// TraceContext identifies a request and its place in a distributed trace, see https://www.w3.org/TR/trace-context/.
+type TraceContext struct {
+	RequestID string
+	// TraceID is 32 hex digits, which is from traceparent header or generated.
+	TraceID string
+	// ParentID is span ID of the caller in traceparent header, empty if there is none.
+	ParentID string
+	// SpanID is 16 hex digits identifies current request, which is the parent of outgoing requests.
+	SpanID string
+	// Flags is trace flags in 2 hex digits, "01" means sampled.
+	Flags string
+	// State is vendor specific tracestate header, which is propagated as it is.
+	State string
+}
+
+// TraceParent returns traceparent header value for outgoing requests.
+func (t *TraceContext) TraceParent() string {
+	return "00-" + t.TraceID + "-" + t.SpanID + "-" + t.Flags
+}
+
+// Inject sets request ID and trace context headers, header is created if it is nil.
+// It is for outgoing requests, e.g. utl.HttpCall(client, "GET", url, trace.Inject(nil), nil).
+func (t *TraceContext) Inject(header http.Header) http.Header {
+	if header == nil {
+		header = make(http.Header)
+	}
+	if len(t.RequestID) > 0 {
+		header.Set(HeaderRequestID, t.RequestID)
+	}
+	if len(t.TraceID) > 0 {
+		header.Set(HeaderTraceParent, t.TraceParent())
+		if len(t.State) > 0 {
+			header.Set(HeaderTraceState, t.State)
+		}
+	}
+	return header
+}
+
+// ParseTraceParent parses traceparent header value, ok is false if it is invalid.
+func ParseTraceParent(s string) (traceID, parentID, flags string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || !isHex(parts[0]) {
+		return "", "", "", false
+	}
+	// Version 00 has exact 4 parts, later versions may append more.
+	if parts[0] == "00" && len(parts) != 4 {
+		return "", "", "", false
+	}
+	traceID, parentID, flags = parts[1], parts[2], parts[3]
+	if len(traceID) != 32 || !isHex(traceID) || traceID == strings.Repeat("0", 32) ||
+		len(parentID) != 16 || !isHex(parentID) || parentID == strings.Repeat("0", 16) ||
+		len(flags) != 2 || !isHex(flags) {
+		return "", "", "", false
+	}
+	return traceID, parentID, flags, true
+}
+
+// isHex returns true if s consists of lowercase hex digits.
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// randomHex returns n random bytes in hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID returns true if request ID from client is safe to log, propagate and show
+// in pages, which consists of letters, digits, '.', '_' and '-'.
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > 64 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') &&
+			c != '.' && c != '_' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// TraceOptions represents a struct for specifying configuration options for the Tracer middleware.
+type TraceOptions struct {
+	// Header to read request ID from. Default is "X-Request-Id".
+	RequestIDHeader string
+	// Whether to send request ID back in response header.
+	ResponseHeader bool
+}
+
+func prepareTraceOptions(options []TraceOptions) TraceOptions {
+	var opt TraceOptions
+	if len(options) > 0 {
+		opt = options[0]
+	}
+
+	conf := GetConfig().Trace
+	if conf == nil {
+		conf = &TraceOpt{}
+	}
+
+	if len(opt.RequestIDHeader) == 0 {
+		opt.RequestIDHeader = conf.RequestIDHeader
+	}
+	if len(opt.RequestIDHeader) == 0 {
+		opt.RequestIDHeader = HeaderRequestID
+	}
+	if !opt.ResponseHeader {
+		opt.ResponseHeader = conf.ResponseHeader
+	}
+	return opt
+}
+
+// Tracer returns a middleware that accepts or generates request ID, and continues trace of
+// W3C traceparent and tracestate headers or starts a new one. *TraceContext is mapped into
+// the injector, "RequestID" and "TraceID" are set in Context.Data, and the request logger
+// logs them as "request_id", "trace_id" and "span_id". Put it before ReqLogger.
+func Tracer(opts ...TraceOptions) Handler {
+	opt := prepareTraceOptions(opts)
+
+	return func(ctx *Context) {
+		t := &TraceContext{
+			RequestID: ctx.Req.Header.Get(opt.RequestIDHeader),
+			SpanID:    randomHex(8),
+		}
+		if !validRequestID(t.RequestID) {
+			t.RequestID = newRequestID()
+		}
+		var ok bool
+		if t.TraceID, t.ParentID, t.Flags, ok = ParseTraceParent(ctx.Req.Header.Get(HeaderTraceParent)); ok {
+			t.State = ctx.Req.Header.Get(HeaderTraceState)
+		} else {
+			t.TraceID, t.Flags = randomHex(16), "01"
+		}
+
+		ctx.requestID = t.RequestID
+		ctx.trace = t
+		ctx.Map(t)
+		ctx.Data["RequestID"] = t.RequestID
+		ctx.Data["TraceID"] = t.TraceID
+		if ctx.Router != nil && ctx.Router.m != nil {
+			ctx.logger = ctx.Router.m.requestLogger(ctx.Req.Request,
+				"request_id", t.RequestID, "trace_id", t.TraceID, "span_id", t.SpanID)
+			ctx.Map(ctx.logger)
+		}
+
+		if opt.ResponseHeader {
+			ctx.Resp.Header().Set(opt.RequestIDHeader, t.RequestID)
+		}
+	}
+}
+
+// Trace returns trace context of current request, it is nil unless Tracer is in use.
+func (c *Context) Trace() *TraceContext {
+	return c.trace
+}
+
+// TraceHeader returns header with request ID and trace context of current request for outgoing
+// requests like utl.HttpCall, header is created if it is nil. Without Tracer only request ID is set.
+func (c *Context) TraceHeader(header http.Header) http.Header {
+	if c.trace != nil {
+		return c.trace.Inject(header)
+	}
+	return (&TraceContext{RequestID: c.requestID}).Inject(header)
+}
@@ -18,9 +18,12 @@ package bigo
 // NOTE: last sync 0c93364 on Dec 19, 2014.
 
 import (
+	"fmt"
+	"net/url"
 	"path"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/fym201/bigo/utl"
 )
@@ -278,6 +281,104 @@ func splitSegment(key string) (bool, []string, string) {
 	}
 }
 
+// segmentRegexps caches compiled restrictions of params for buildSegment.
+var segmentRegexps sync.Map
+
+// matchSegmentParam returns true if val matches the param restriction exp.
+func matchSegmentParam(exp, val string) bool {
+	reg, ok := segmentRegexps.Load(exp)
+	if !ok {
+		reg, _ = segmentRegexps.LoadOrStore(exp, regexp.MustCompile("^"+exp+"$"))
+	}
+	return reg.(*regexp.Regexp).MatchString(val)
+}
+
+// escapeSplat escapes each part of a splat value but keeps the slashes between them.
+func escapeSplat(val string) string {
+	parts := strings.Split(val, "/")
+	for i := range parts {
+		parts[i] = url.PathEscape(parts[i])
+	}
+	return strings.Join(parts, "/")
+}
+
+// buildSegment rebuilds a segment with given params, it is the reverse of splitSegment.
+// Values of params with :int, :string or regexp restriction must match the restriction.
+// Values are path escaped, slashes in splat values are kept.
+//
+// Examples:
+// 		"admin" -> "admin"
+// 		":id" + {":id": "1"} -> "1"
+// 		"?:id" + {} -> ""
+// 		"cms_:id([0-9]+).html" + {":id": "1"} -> "cms_1.html"
+// 		"*" + {":splat": "a/b"} -> "a/b"
+// 		"*.*" + {":path": "a/b", ":ext": "html"} -> "a/b.html"
+func buildSegment(seg string, params map[string]string) (string, error) {
+	if strings.HasPrefix(seg, "*") {
+		if seg == "*.*" {
+			if len(params[":ext"]) == 0 {
+				return escapeSplat(params[":path"]), nil
+			}
+			return escapeSplat(params[":path"]) + "." + url.PathEscape(params[":ext"]), nil
+		}
+		return escapeSplat(params[":splat"]), nil
+	}
+	if !strings.Contains(seg, ":") {
+		return seg, nil
+	}
+
+	out := make([]byte, 0, len(seg))
+	optional := false
+	for i := 0; i < len(seg); {
+		switch seg[i] {
+		case '?':
+			optional = true
+			i++
+		case ':':
+			j := i + 1
+			for j < len(seg) && isParamChar(seg[j]) {
+				j++
+			}
+			name := ":" + seg[i+1:j]
+
+			var exp string
+			if strings.HasPrefix(seg[j:], ":int") {
+				exp = "[0-9]+"
+				j += 4
+			} else if strings.HasPrefix(seg[j:], ":string") {
+				exp = `[\w]+`
+				j += 7
+			} else if j < len(seg) && seg[j] == '(' {
+				end := strings.Index(seg[j:], ")")
+				if end == -1 {
+					return "", fmt.Errorf("unclosed regexp in segment %q", seg)
+				}
+				exp = seg[j : j+end+1]
+				j += end + 1
+			}
+
+			val, ok := params[name]
+			if !ok && !optional {
+				return "", fmt.Errorf("missing param %s", name)
+			}
+			if ok && len(exp) > 0 && !matchSegmentParam(exp, val) {
+				return "", fmt.Errorf("param %s=%q does not match %s", name, val, exp)
+			}
+			out = append(out, url.PathEscape(val)...)
+			i = j
+		default:
+			out = append(out, seg[i])
+			i++
+		}
+	}
+	return string(out), nil
+}
+
+// isParamChar returns true if the byte is allowed in param name.
+func isParamChar(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
 // addSegments add segments to the router tree.
 func (t *Tree) addSegments(segments []string, handle Handle, wildcards []string, reg string) {
 	// Fixed root route.
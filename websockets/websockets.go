@@ -70,6 +70,12 @@ type Options struct {
 
 	// The receiving channel buffer
 	RecvChannelBuffer int
+
+	// The registry to record metrics of connections by route pattern in, default is bigo.DefaultMetrics
+	Metrics *bigo.MetricsRegistry
+
+	// The prefix of metric names, default is Namespace of Metrics config or "bigo"
+	Namespace string
 }
 
 type Connection struct {
@@ -216,6 +222,10 @@ func JSON(bindStruct interface{}, options ...*Options) bigo.Handler {
 
 // Generates a handler from an interface
 func makeHandler(binding interface{}, o *Options) bigo.Handler {
+	connections := o.Metrics.Gauge(o.Namespace+"_websocket_connections",
+		"Number of open websocket connections.", "route")
+	connectionsTotal := o.Metrics.Counter(o.Namespace+"_websocket_connections_total",
+		"Total number of accepted websocket connections.", "route")
 
 	return func(ctx *bigo.Context) {
 		// Upgrade the request to a websocket connection
@@ -238,10 +248,20 @@ func makeHandler(binding interface{}, o *Options) bigo.Handler {
 		// Map the Channels <-chan error, <-chan bool and chan<- bool
 		c.mapDefaultChannels(ctx)
 
+		route := ""
+		if r := ctx.CurrentRoute(); r != nil {
+			route = r.Pattern()
+		}
+		connectionsTotal.Inc(route)
+		connections.Inc(route)
+
 		// start the send and receive goroutines
 		go c.send()
 		go c.recv()
-		go waitForDisconnect(c)
+		go func() {
+			waitForDisconnect(c)
+			connections.Dec(route)
+		}()
 
 		// call the next handler, which must block
 		ctx.Next()
@@ -636,6 +656,10 @@ func newConnection(ws *websocket.Conn, o *Options) *Connection {
 
 // Creates new default options and assigns any given options
 func newOptions(options []*Options) *Options {
+	namespace := "bigo"
+	if metrics := bigo.GetConfig().Metrics; metrics != nil && len(metrics.Namespace) > 0 {
+		namespace = metrics.Namespace
+	}
 
 	o := Options{
 		bigo.NewLogger(bigo.DefaultLoggerWriter(), "[WS] ", 0),
@@ -647,6 +671,8 @@ func newOptions(options []*Options) *Options {
 		defaultMaxMessageSize,
 		defaultSendChannelBuffer,
 		defaultRecvChannelBuffer,
+		bigo.DefaultMetrics,
+		namespace,
 	}
 
 	// when all defaults, return it